@@ -1,3 +1,3 @@
 module github.com/mitranim/gtg
 
-go 1.15
+go 1.21
@@ -13,10 +13,12 @@ package gtg
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
+	"math"
+	"math/rand"
 	"os"
-	"reflect"
-	"runtime"
 	"strings"
 	"time"
 	"unsafe"
@@ -57,6 +59,105 @@ type Task interface {
 	TaskGroup
 }
 
+/*
+Configuration of a task group/graph. The zero value is valid, and is used by
+`Start`, `Run` and `RunCmd`. Methods of `Conf` behave like the package-level
+functions of the same name, creating a group with this configuration.
+*/
+type Conf struct {
+	// Receives events about every task in the group. Nil means task events are
+	// dropped, while errors logged by `Opt` go to `DefaultObserver`. To log
+	// the timing of every task, use `Logger{}`.
+	Observer Observer
+
+	// If set, `Run` and `RunCmd` write a `Summary` of task timing there after
+	// the main task finishes, followed by the `CriticalPath`. `RunCmd` sets it
+	// to stderr when given the "--summary" flag.
+	Summary io.Writer
+
+	// If set, `Run` and `RunCmd` write a trace of all tasks there after the main
+	// task finishes; see `WriteTrace`. `RunCmd` sets it to a file when given the
+	// "--trace=<file>" flag.
+	Trace io.Writer
+
+	// If true, the failure of any task cancels the context shared by all tasks
+	// in the group, so that other tasks can stop promptly, instead of running
+	// until the main task finishes. The cancellation cause, available via
+	// `context.Cause`, is the error of the failed task. Failures handled by
+	// waiting tasks are exempt: a task that another task waits on, such as via
+	// `Wait` or `Par`, cancels the group only if its failure propagates to a
+	// task that nothing waits on, such as the main task. Failures swallowed by
+	// `Opt` or `Fallback` don't cancel the group. `RunCmd` enables this when
+	// given the "--fail-fast" flag.
+	FailFast bool
+
+	// Capacities of named resources, which tasks acquire via `Acquire`.
+	// Resources not listed here have a capacity of 1.
+	Resources map[string]int
+
+	// Applied to every task function in the group when its task starts; see
+	// `Middleware`.
+	Middleware []Middleware
+
+	// Values available to all tasks in the group via `Get`. See `Provider`.
+	Values []Provider
+
+	// If true, tasks don't execute their functions. Instead, they wait for
+	// their prerequisites declared via `Deps`, check whether they're up to
+	// date via `Fresh`, and finish with `StatusSkipped`, noting whether they
+	// would run. Dependencies expressed only by `Wait` calls inside task
+	// functions aren't discovered. See `MakePlan`. `RunCmd` enables this and
+	// prints the plan when given the "--dry-run" flag.
+	DryRun bool
+
+	// If true, `Run` and `RunCmd` record which tasks succeeded in `StateFile`,
+	// and skip tasks that succeeded in the previous run, with the note
+	// "succeeded in previous run". Tasks with inputs declared via `Inputs` are
+	// skipped only if the hash of their inputs is unchanged. Tasks are
+	// identified by the full names of their functions, including the package
+	// path. Closures, including functions created by `Ser`, `Par`, `Opt`,
+	// `Timeout` and `Retry`, can't be identified this way, and always run.
+	// After a successful run, the file is removed, and the next run starts
+	// from scratch. `RunCmd` enables this when given the "--resume" flag.
+	Resume bool
+
+	// Used when `Resume` is true. Empty means `DefaultStateFile`.
+	StateFile string
+
+	// If positive, after the main task finishes and the group's context is
+	// canceled, `Run` and `RunCmd` wait up to this long for other tasks in the
+	// group, such as tasks started and never waited on; see `WaitAll`. Tasks
+	// still running afterwards are logged as an error. `RunCmd` treats zero as
+	// `DefaultDrain`; negative values disable waiting.
+	Drain time.Duration
+}
+
+// Used by `RunCmd` when `Conf.Drain` is zero.
+const DefaultDrain = 10 * time.Second
+
+/*
+Wraps a task function to add cross-cutting behavior, such as logging, tracing,
+retries, or setting up the context. Configured via `Conf.Middleware`, where the
+first middleware is the outermost. Middleware is applied when a task starts, and
+doesn't affect task identity: tasks are still deduplicated and named by the
+original function. Every middleware receives the name of the task, as reported
+to observers, because only the innermost one receives the original function;
+outer ones receive the result of the next one. Example:
+
+	conf := Conf{Middleware: []Middleware{
+		func(name string, fun TaskFunc) TaskFunc {
+			return func(task Task) error {
+				log.Println("running", name)
+				return fun(task)
+			}
+		},
+		func(_ string, fun TaskFunc) TaskFunc {
+			return Retry(RetryPolicy{Attempts: 3}, fun)
+		},
+	}}
+*/
+type Middleware func(name string, fun TaskFunc) TaskFunc
+
 /*
 Creates a new task group/graph. Runs `fun` as the first task in the group, on
 another goroutine, and returns that first task.
@@ -64,7 +165,53 @@ another goroutine, and returns that first task.
 Honoring context cancellation is up to the task function.
 */
 func Start(ctx context.Context, fun TaskFunc) Task {
-	return (&taskGroup{ctx: ctx}).Task(fun)
+	return Conf{}.Start(ctx, fun)
+}
+
+// See `Start`.
+func (self Conf) Start(ctx context.Context, fun TaskFunc) Task {
+	return newTaskGroup(ctx, self).Task(fun)
+}
+
+/*
+Creates a subgroup of the group of the given task, with its own deduplication:
+task functions already run in the parent group run again in the subgroup. This
+allows to run the same tasks several times in one process, for example for
+several targets:
+
+	func Deploy(task Task) error {
+		var funs []TaskFunc
+		for _, target := range []string{"staging", "production"} {
+			group := Sub(task, target, Build)
+			funs = append(funs, func(Task) error {
+				return Wait(group, Upload)
+			})
+		}
+		return Par(funs...)(task)
+	}
+
+The subgroup inherits the context and the configuration of the parent group,
+including the observer, middleware and resources, which are shared with the
+parent. The given task is used only to find the parent group: the subgroup
+outlives it, and may be used after it finishes. The listed task functions are
+shared prerequisites: they're looked up in the parent group rather than run
+again.
+
+With `Conf.FailFast`, a failure in the subgroup cancels the tasks of the
+subgroup, but not the parent group. Canceling the parent group cancels the
+subgroup. A failure in the subgroup cancels the parent group only when it
+propagates to a task of the parent group that nothing waits on, as usual.
+
+Tasks in a subgroup are named with its name as a prefix, as in
+"staging/Upload", and are included in `Snapshot`, `Summarize` and similar
+reports of the parent group, as well as in `WaitAll`.
+*/
+func Sub(task Task, name string, shared ...TaskFunc) TaskGroup {
+	tg := groupOf(task)
+	if tg == nil {
+		return newTaskGroup(task, Conf{})
+	}
+	return tg.sub(name, shared)
 }
 
 // Shortcut for `Must(Run())`.
@@ -77,12 +224,18 @@ Creates a new task group/graph. Runs `fun` as the first task in the group,
 blocks until it finishes, and returns its error.
 
 When this "main" task finishes, the context provided to all tasks in this group
-is canceled.
+is canceled. Other tasks may still be running; to wait for them, use
+`Conf.Drain`.
 */
 func Run(ctx context.Context, fun TaskFunc) error {
-	ctx, cancel := context.WithCancel(ctx)
-	defer cancel()
-	return waitFor(Start(ctx, fun))
+	return Conf{}.Run(ctx, fun)
+}
+
+// See `Run`.
+func (self Conf) Run(ctx context.Context, fun TaskFunc) error {
+	main, err := self.run(ctx, fun)
+	self.report(main)
+	return err
 }
 
 // Shortcut for `Must(Wait())`.
@@ -95,7 +248,49 @@ Finds or starts the task in the given group identified by the given function,
 and waits for it on the current goroutine, returning its error.
 */
 func Wait(group TaskGroup, fun TaskFunc) error {
-	return waitFor(group.Task(fun))
+	dep := request(group, fun)
+	defer waiting(group, dep)()
+	return waitFor(dep)
+}
+
+/*
+Waits until every task in the group of the given task or group has finished,
+including tasks created while waiting. Unlike `Wait`, this covers tasks that
+nothing waits on, such as cleanup tasks started via `TaskGroup.Task` and left
+running. A positive timeout limits the wait; on timeout, returns an error
+naming the tasks still running. Shouldn't be called from a task of the same
+group, because it would wait for itself.
+
+`Run` and `RunCmd` use this after the main task finishes; see `Conf.Drain`.
+*/
+func WaitAll(group TaskGroup, timeout time.Duration) error {
+	tg := groupOf(group)
+	if tg == nil {
+		return fmt.Errorf(`can't wait for unknown task group %T`, group)
+	}
+
+	var deadline <-chan time.Time
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		deadline = timer.C
+	}
+
+	for count := 0; ; {
+		tasks := tg.all()
+		if count >= len(tasks) {
+			return nil
+		}
+
+		for _, task := range tasks[count:] {
+			select {
+			case <-task.done:
+			case <-deadline:
+				return tg.stillRunning(timeout)
+			}
+		}
+		count = len(tasks)
+	}
 }
 
 /*
@@ -112,6 +307,8 @@ The main use is for composition:
 
 This is a convenience feature for CLI scripts. Apps usually do their own
 logging, and would write their own version of this function.
+
+With `Conf.FailFast`, the failure of an optional task doesn't cancel the group.
 */
 func Opt(fun TaskFunc) TaskFunc {
 	/**
@@ -119,11 +316,211 @@ func Opt(fun TaskFunc) TaskFunc {
 	and it didn't seem to help.
 	*/
 	return func(task Task) error {
-		Log(Wait(task, fun))
+		logErr(task, Wait(task, fun))
 		return nil
 	}
 }
 
+/*
+Wraps a task function, giving it a deadline. When the deadline expires, the
+context of the function is canceled, and the task fails with an error that
+mentions the name of the function and satisfies:
+
+	errors.Is(err, context.DeadlineExceeded)
+
+This happens even if the function ignores cancellation; in that case, it keeps
+running on another goroutine, and its eventual result is ignored. Usage:
+
+	var styles = Timeout(time.Minute, Sass)
+
+	func Build(task Task) error {
+		return Wait(task, styles)
+	}
+
+Each call to `Timeout` creates a new function, which is a separate task; see
+`TaskFunc`. Define the wrapped function once to deduplicate it.
+*/
+func Timeout(dur time.Duration, fun TaskFunc) TaskFunc {
+	return func(task Task) error {
+		ctx, cancel := context.WithTimeout(task, dur)
+		defer cancel()
+
+		done := make(chan taskResult, 1)
+		go func() { done <- callTask(fun, withContext(task, ctx)) }()
+
+		timeout := func() error {
+			return fmt.Errorf(`task %q timed out after %v: %w`, fun.ShortName(), dur, context.DeadlineExceeded)
+		}
+
+		select {
+		case res := <-done:
+			if res.err != nil && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				return timeout()
+			}
+			return res.get()
+
+		case <-ctx.Done():
+			if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				return timeout()
+			}
+			// Canceled from the outside. Honoring that is up to the function.
+			return (<-done).get()
+		}
+	}
+}
+
+/*
+Configures `Retry`. The zero value makes one attempt, without retrying.
+*/
+type RetryPolicy struct {
+	// Maximum number of attempts, including the first one. Values below 1 are
+	// treated as 1.
+	Attempts int
+
+	// Delay before the second attempt. Doubles after every attempt.
+	Delay time.Duration
+
+	// Maximum delay between attempts. Zero means unlimited, except that the
+	// delay stops doubling before it would overflow.
+	MaxDelay time.Duration
+
+	// Fraction of each delay, between 0 and 1, that is randomly subtracted from
+	// it, to avoid retrying many tasks at once.
+	Jitter float64
+
+	// Decides which errors are worth retrying. Nil means all errors.
+	Retryable func(error) bool
+}
+
+/*
+Wraps a task function, calling it again when it fails, according to the given
+policy. A panic with an error value, such as from `Must`, also counts as a
+failure. Waits between attempts with exponential backoff, stopping early if the
+task's context is canceled. Each retry is reported to the group's observer as
+`EventRetrying`, and the final `TaskError` reports the number of attempts.
+Usage:
+
+	var download = Retry(RetryPolicy{Attempts: 3, Delay: time.Second}, Download)
+
+Each call to `Retry` creates a new function, which is a separate task; see
+`TaskFunc`. Define the wrapped function once to deduplicate it.
+*/
+func Retry(policy RetryPolicy, fun TaskFunc) TaskFunc {
+	return func(task Task) error {
+		inner, _ := task.(taskInner)
+
+		for attempt := 1; ; attempt++ {
+			if inner.task != nil {
+				inner.task.setAttempts(attempt)
+			}
+
+			err := callTask(fun, task).getErr()
+			if err == nil || attempt >= policy.Attempts || !policy.retryable(err) {
+				return err
+			}
+
+			delay := policy.delay(attempt)
+			if inner.task != nil {
+				inner.task.emit(Event{
+					Kind:     EventRetrying,
+					Task:     inner.task.name(),
+					Attempt:  attempt,
+					Duration: delay,
+					Err:      err,
+				})
+			}
+
+			if !sleep(task, delay) {
+				return errors.Join(err, task.Err())
+			}
+		}
+	}
+}
+
+func (self RetryPolicy) retryable(err error) bool {
+	return self.Retryable == nil || self.Retryable(err)
+}
+
+// Delay after the given attempt, starting with 1.
+func (self RetryPolicy) delay(attempt int) time.Duration {
+	delay := self.Delay
+	for ind := 1; ind < attempt; ind++ {
+		if delay <= 0 || delay > math.MaxInt64/2 || (self.MaxDelay > 0 && delay >= self.MaxDelay) {
+			break
+		}
+		delay *= 2
+	}
+	if self.MaxDelay > 0 && delay > self.MaxDelay {
+		delay = self.MaxDelay
+	}
+	if self.Jitter > 0 {
+		delay -= time.Duration(rand.Float64() * math.Min(self.Jitter, 1) * float64(delay))
+	}
+	return delay
+}
+
+/*
+Creates a task function that runs the given task only if the condition is true
+at the time of running, otherwise skipping it. The condition may check anything,
+such as the presence of a file or an executable. A skipped task is not created;
+the conditional task itself finishes with `StatusSkipped`, reported to the
+group's observer as `EventSkipped`. Usage:
+
+	func hasSass(Task) bool {
+		_, err := exec.LookPath("sass")
+		return err == nil
+	}
+
+	func Build(task Task) error {
+		return Wait(task, Unless(hasSass, installSass))
+	}
+
+The resulting function is named after its arguments, as in
+"If(hasSass, installSass)". For the same arguments, `If` returns the same
+function, which is deduplicated like any other.
+
+Functions created by `If`, `Unless` and `Fallback` are registered for the
+lifetime of the process, and are never freed. With statically defined arguments,
+this is a fixed cost. Passing closures created anew on every call, such as
+inside a task function that runs many times, grows memory without bound; define
+such closures once, or use a statically defined function.
+*/
+func If(cond func(Task) bool, fun TaskFunc) TaskFunc {
+	return conditional(`If`, cond, true, fun)
+}
+
+// Inverse of `If`: runs the given task only if the condition is false.
+func Unless(cond func(Task) bool, fun TaskFunc) TaskFunc {
+	return conditional(`Unless`, cond, false, fun)
+}
+
+/*
+Creates a task function that runs the primary task, and if it fails, runs the
+secondary task instead, returning its result. The failure of the primary task is
+reported to the group's observer as `EventFallback`. With `Conf.FailFast`, it
+doesn't cancel the group. Usage:
+
+	MustWait(task, Fallback(fetchCache, build))
+
+The resulting function is named after its arguments, as in
+"Fallback(fetchCache, build)". For the same arguments, `Fallback` returns the
+same function, which is deduplicated like any other. Like with `If`, avoid
+passing closures created anew on every call.
+*/
+func Fallback(primary, secondary TaskFunc) TaskFunc {
+	name := fmt.Sprintf(`Fallback(%v, %v)`, primary.ShortName(), secondary.ShortName())
+
+	return derive(name, []uintptr{primary.id(), secondary.id()}, func(task Task) error {
+		err := Wait(task, primary)
+		if err == nil {
+			return nil
+		}
+
+		emit(task, Event{Kind: EventFallback, Task: primary.ShortName(), Dep: secondary.ShortName(), Err: err})
+		return Wait(task, secondary)
+	})
+}
+
 /*
 Short for "serial". Creates a task function that will wait on the given tasks
 in a sequence.
@@ -132,8 +529,9 @@ As always, any task in the current group is run only once. A task that finished
 earlier will not be called again. The actual order of task execution may not
 match the order in `Ser`.
 
-Currently in Gtg, parallel takes priority over serial; making sure that no other
-task is trying to run everything in parallel is on the user.
+In `Ser`, parallel takes priority over serial; making sure that no other task is
+trying to run everything in parallel is on the user. For a guaranteed order,
+use `Ordered`.
 */
 func Ser(funs ...TaskFunc) TaskFunc {
 	// TODO: figure out how to give it a name other than `func1`.
@@ -148,6 +546,48 @@ func Ser(funs ...TaskFunc) TaskFunc {
 	}
 }
 
+/*
+Like `Ser`, but guarantees the order of execution. Before running the given
+tasks, registers ordering constraints in the current group via `Order`, so that
+each task starts only after the previous one finishes, even when another task
+requests it concurrently. Returns an error if some of the tasks were already
+started out of order.
+*/
+func Ordered(funs ...TaskFunc) TaskFunc {
+	return func(task Task) error {
+		err := Order(task, funs...)
+		if err != nil {
+			return err
+		}
+		return Ser(funs...)(task)
+	}
+}
+
+/*
+Declares that, in the given group, the task of each function must not start
+before the task of the previous function finishes. This is a real edge in the
+task graph: whoever requests a later task, it first waits on the earlier one,
+starting it if necessary, and fails if the earlier one fails. Usage:
+
+	func Main(task Task) error {
+		Must(Order(task, Clean, Build))
+
+		// `Build` doesn't start until `Clean` is finished.
+		return Wait(task, Par(Build, Clean))
+	}
+
+Constraints must be declared before the affected tasks are started. Returns an
+error if a task was already started before its predecessor finished, or if the
+constraints would form a cycle. Constraints declared before the error remain.
+*/
+func Order(group TaskGroup, funs ...TaskFunc) error {
+	tg := groupOf(group)
+	if tg == nil {
+		return fmt.Errorf(`can't order tasks in unknown task group %T`, group)
+	}
+	return tg.order(funs)
+}
+
 /*
 Short for "parallel" (although "concurrent" would be more precise). Creates a
 task function that will request all given tasks to be run concurrently.
@@ -168,21 +608,126 @@ func Par(funs ...TaskFunc) TaskFunc {
 
 		wg := makeWaitGroup(len(funs))
 		for _, fun := range funs {
-			wg.add(task.Task(fun))
+			wg.add(request(task, fun))
 		}
+		defer waiting(task, wg.tasks...)()
 		return wg.wait()
 	}
 }
 
 /*
-Convenience function for CLI. If the error is non-nil, logs it, otherwise
-ignores it:
+Creates a task function for one cell of a matrix: the given template applied to
+the given parameter. The function is named after the template and the
+parameter, formatted via `fmt.Sprint`:
+
+	func test(task Task, target string) error {
+		return Capture(...)
+	}
+
+	Cell(test, "linux/amd64").ShortName() // "test[linux/amd64]"
+
+For the same template and formatted parameter, `Cell` returns the same function,
+which is deduplicated like any other. Parameters are told apart only by their
+formatting: distinct parameters that format the same, such as values of a type
+whose `String` method ignores some fields, are the same cell, which uses the
+first of them. Also see `Matrix` and `Cells`.
+*/
+func Cell[P any](fun func(Task, P) error, param P) TaskFunc {
+	name := fmt.Sprintf(`%v[%v]`, funcShortName(funcLongName(fun)), param)
+	id := *(*uintptr)(unsafe.Pointer(&fun))
+
+	return derive(name, []uintptr{id}, func(task Task) error {
+		return fun(task, param)
+	})
+}
+
+/*
+Returns the cells of a matrix; see `Cell`. Useful for making each cell available
+on the command line:
+
+	MustRunCmd(append(Cells(test, targets...), build)...)
+*/
+func Cells[P any](fun func(Task, P) error, params ...P) []TaskFunc {
+	out := make([]TaskFunc, 0, len(params))
+	for _, param := range params {
+		out = append(out, Cell(fun, param))
+	}
+	return out
+}
+
+/*
+Creates a task function that fans out the given template over a set of
+parameters, running one task per parameter concurrently; see `Cell`. Usage:
+
+	func Test(task Task) error {
+		return Wait(task, Matrix(test, "linux/amd64", "darwin/arm64"))
+	}
+
+Like `Par`, fails as soon as any cell fails, without waiting for the others,
+which keep running. Each cell is a separate task, reported to the group's
+observer under its own name, and included in `Snapshot` and `Summarize`. To
+wait for every cell and get the errors of all failed cells, use `MatrixAll`.
+*/
+func Matrix[P any](fun func(Task, P) error, params ...P) TaskFunc {
+	return matrix(`Matrix`, false, Cells(fun, params...))
+}
+
+/*
+Like `Matrix`, but waits for every cell, even if some of them fail, so that the
+result of every cell is known. If any cells fail, the resulting error lists all
+failed cells.
+*/
+func MatrixAll[P any](fun func(Task, P) error, params ...P) TaskFunc {
+	return matrix(`MatrixAll`, true, Cells(fun, params...))
+}
+
+/*
+Creates a task function that runs all given tasks concurrently, and succeeds as
+soon as any of them succeeds, canceling the inner contexts of the others.
+Returns an error only if every task fails, joining all their errors. Useful for
+trying several equivalent sources at once, such as mirrors.
+
+Canceling is cooperative: it's up to the losing task functions to honor their
+context. Because tasks are deduplicated, a losing task may also be used by other
+tasks, which will observe its cancellation. For a version that leaves the
+losing tasks running, use `First`.
+
+With `Conf.FailFast`, failures of the given tasks, including losing tasks
+canceled by `Race`, don't cancel the group. If every task fails, the resulting
+error does, unless something handles it.
+*/
+func Race(funs ...TaskFunc) TaskFunc {
+	return func(task Task) error {
+		winner, tasks, err := first(task, funs)
+		for _, val := range tasks {
+			if val != winner {
+				abort(val, fmt.Errorf(`lost race to task %q`, taskName(winner)))
+			}
+		}
+		return err
+	}
+}
+
+/*
+Like `Race`, but doesn't cancel the other tasks once one of them succeeds. They
+keep running, and their results remain available to other tasks.
+*/
+func First(funs ...TaskFunc) TaskFunc {
+	return func(task Task) error {
+		_, _, err := first(task, funs)
+		return err
+	}
+}
+
+/*
+Convenience function for CLI. If the error is non-nil, logs it via
+`DefaultObserver`, otherwise ignores it:
 
 	Log(Wait(task, AnotherTask))
 */
 func Log(err error) {
 	if err != nil {
-		_, _ = fmt.Fprintf(logOutput, "[gtg] error: %+v\n", err)
+		DefaultObserver.Observe(Event{Kind: EventError, Time: time.Now(), Err: err})
 	}
 }
 
@@ -205,15 +750,80 @@ func MustRunCmd(funs ...TaskFunc) {
 /*
 Convenience function for CLI. Selects one task function via `Choose`, using the
 command line arguments from `os.Args`. Runs this task and returns its error.
+Before returning, waits for other tasks in the group, up to `Conf.Drain` or
+`DefaultDrain`, so that their output isn't cut off when the program exits.
+
+Arguments starting with "-" are flags, rather than task names, and may be mixed
+with task names. Flags with values must use the "=" form. Supported flags:
+
+	--summary         print timing of all tasks and the critical path afterwards;
+	                  see `Conf.Summary`
+	--trace=<file>    write a Chrome trace of all tasks after running; see
+	                  `WriteTrace`
+	--fail-fast       cancel all tasks when any task fails; see `Conf.FailFast`
+	--progress        show running tasks live on a terminal; see `Progress`
+	--dry-run         print the plan instead of running tasks; see `Conf.DryRun`
+	--resume          skip tasks that succeeded in the previous run with this
+	                  flag; see `Conf.Resume`
+	--graph=<file>    write the graph of declared dependencies instead of running;
+	                  see `WriteGraph`
+	--report=<format>:<file>
+	                  write a report for CI after running; formats: junit, tap;
+	                  may be repeated; without a file, writes to stdout; see
+	                  `WriteJUnit` and `WriteTAP`
+	--json[=<file>]   write events as newline-delimited JSON to stdout or a file;
+	                  see `JSONObserver`
+	--help            list known tasks with declared dependencies, and flags
 
 CLI scripts can use the `MustRunCmd` shortcut.
 */
 func RunCmd(funs ...TaskFunc) error {
-	fun, err := Choose(os.Args[1:], funs)
+	return Conf{}.RunCmd(funs...)
+}
+
+// See `RunCmd`.
+func (self Conf) RunCmd(funs ...TaskFunc) error {
+	flags, names, err := parseCmdArgs(os.Args[1:])
+	if err != nil {
+		return err
+	}
+
+	if flags.help {
+		return writeHelp(logOutput, funs)
+	}
+
+	fun, err := Choose(names, funs)
+	if err != nil {
+		return err
+	}
+
+	if flags.graph != "" {
+		return writeGraphFile(flags.graph, fun)
+	}
+
+	if self.Drain == 0 {
+		self.Drain = DefaultDrain
+	}
+
+	conf, env, err := self.withFlags(flags)
+	if err != nil {
+		_ = env.close()
+		return err
+	}
+
+	main, err := conf.run(context.Background(), fun)
+	env.stopProgress()
+	conf.report(main)
+	env.report(main)
+	if conf.DryRun {
+		_, _ = MakePlan(main).WriteTo(logOutput)
+	}
+
+	closeErr := env.close()
 	if err != nil {
 		return err
 	}
-	return Run(context.Background(), fun)
+	return closeErr
 }
 
 /*
@@ -254,6 +864,56 @@ func Choose(names []string, funs []TaskFunc) (TaskFunc, error) {
 	return chosen[0], nil
 }
 
+/*
+Error of a failed or panicked task, as returned by `Task.Err()` when seen from
+the "outside", and by `Wait`. Annotates the error of the task function with the
+task name. Supports `errors.Is` and `errors.As` via `Unwrap`.
+*/
+type TaskError struct {
+	// Short name of the task function.
+	Task string
+
+	// Error returned by the task function, or its panic. A panic with a
+	// non-error value is converted to an error.
+	Err error
+
+	// True if the task function panicked.
+	Panicked bool
+
+	// How many times the task function was attempted. More than 1 when using
+	// `Retry`. Zero if it never started, for example when a prerequisite failed.
+	Attempts int
+}
+
+// Implement `error`.
+func (self *TaskError) Error() string {
+	return self.prefix() + self.Err.Error()
+}
+
+// Implement `errors.Unwrap`.
+func (self *TaskError) Unwrap() error { return self.Err }
+
+/*
+Implement `fmt.Formatter`. Unlike `fmt.Errorf`, this preserves extended
+formatting of the inner error, such as stacktraces of 3rd party error packages
+printed via "%+v".
+*/
+func (self *TaskError) Format(out fmt.State, verb rune) {
+	_, _ = io.WriteString(out, self.prefix())
+	_, _ = fmt.Fprintf(out, fmt.FormatString(out, verb), self.Err)
+}
+
+func (self *TaskError) prefix() string {
+	var attempts string
+	if self.Attempts > 1 {
+		attempts = fmt.Sprintf(` after %v attempts`, self.Attempts)
+	}
+	if self.Panicked {
+		return fmt.Sprintf(`task %q panicked%v: `, self.Task, attempts)
+	}
+	return fmt.Sprintf(`task %q erred%v: `, self.Task, attempts)
+}
+
 /*
 Task functions may be invoked by `Start`, `Run`, `Task.Task`, and so on. They
 shouldn't be called manually, because the purpose of this package is to
@@ -270,13 +930,26 @@ Returns the function's name without the package path:
 
 	func A(task Task) error {}
 	TaskFunc(A).ShortName() // "A"
+
+Functions created by combinators such as `If` and `Fallback` have descriptive
+names:
+
+	If(hasSass, installSass).ShortName() // "If(hasSass, installSass)"
 */
 func (self TaskFunc) ShortName() string {
+	name, ok := derivedName(self)
+	if ok {
+		return name
+	}
 	return funcShortName(self.longName())
 }
 
 func (self TaskFunc) longName() string {
-	return runtime.FuncForPC(reflect.ValueOf(self).Pointer()).Name()
+	name, ok := derivedName(self)
+	if ok {
+		return name
+	}
+	return funcLongName(self)
 }
 
 /*
@@ -304,7 +977,8 @@ func (self TaskFunc) equal(other TaskFunc) bool {
 }
 
 /*
-Convenience function for CLI. Logs execution time of a task function. Usage:
+Convenience function for CLI. Logs execution time of a task function via
+`DefaultObserver`. Usage:
 
 	func SomeTask(Task) error {
 		defer TaskTiming(SomeTask)()
@@ -315,14 +989,16 @@ Output:
 
 	[SomeTask] starting
 	[SomeTask] done in 1μs
+
+Task groups also measure every task automatically; see `Summarize`.
 */
 func TaskTiming(fun TaskFunc) func() {
 	return Timing(fun.ShortName())
 }
 
 /*
-Convenience function for CLI. Logs execution time of an arbitrary function.
-Usage:
+Convenience function for CLI. Logs execution time of an arbitrary function via
+`DefaultObserver`. Usage:
 
 	func SomeFunc() {
 		defer Timing("some_task")()
@@ -335,10 +1011,10 @@ Output:
 */
 func Timing(name string) func() {
 	start := time.Now()
-	_, _ = fmt.Fprintf(logOutput, "[%v] starting\n", name)
+	DefaultObserver.Observe(Event{Kind: EventStarted, Time: start, Task: name})
 
 	return func() {
 		end := time.Now()
-		_, _ = fmt.Fprintf(logOutput, "[%v] done in %v\n", name, end.Sub(start))
+		DefaultObserver.Observe(Event{Kind: EventFinished, Time: end, Task: name, Duration: end.Sub(start)})
 	}
 }
@@ -0,0 +1,195 @@
+package gtg
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/*
+Writes the tasks of the given group as a JUnit XML report, which most CI systems
+can display. Each task is a test case, in order of creation. Failed tasks are
+failures, panicked tasks are errors, and skipped tasks, including tasks that
+were up to date or resumed, are skipped, with the reason as the message. The
+output of each task, see `Output`, is included as "system-out". Tasks that
+haven't finished are skipped too. Should be used after the run is finished.
+
+CLI scripts can use the "--report=junit:<file>" flag of `RunCmd`.
+*/
+func WriteJUnit(out io.Writer, group TaskGroup) error {
+	tasks := Snapshot(group)
+	suite := junitSuite{Name: "gtg", Tests: len(tasks)}
+
+	var first, last time.Time
+	for _, val := range tasks {
+		if first.IsZero() || val.Created.Before(first) {
+			first = val.Created
+		}
+		if val.Ended.After(last) {
+			last = val.Ended
+		}
+
+		test := junitCase{
+			Name:      val.Task,
+			ClassName: "gtg",
+			Time:      seconds(ciDuration(val)),
+			Out:       val.Output,
+		}
+
+		switch val.Status {
+		case StatusFailed:
+			suite.Failures++
+			test.Failure = &junitProblem{Message: errMessage(val.Err), Body: fmt.Sprintf(`%+v`, val.Err)}
+		case StatusPanicked:
+			suite.Errors++
+			test.Error = &junitProblem{Message: errMessage(val.Err), Body: fmt.Sprintf(`%+v`, val.Err)}
+		case StatusSkipped, StatusPending, StatusRunning:
+			suite.Skipped++
+			test.Skipped = &junitProblem{Message: skipMessage(val)}
+		}
+		suite.Cases = append(suite.Cases, test)
+	}
+
+	if !first.IsZero() {
+		suite.Timestamp = first.Format(time.RFC3339)
+		suite.Time = seconds(last.Sub(first))
+	}
+
+	_, err := io.WriteString(out, xml.Header)
+	if err != nil {
+		return err
+	}
+
+	enc := xml.NewEncoder(out)
+	enc.Indent("", "  ")
+	err = enc.Encode(junitSuites{
+		Name:     suite.Name,
+		Tests:    suite.Tests,
+		Failures: suite.Failures,
+		Errors:   suite.Errors,
+		Skipped:  suite.Skipped,
+		Time:     suite.Time,
+		Suites:   []junitSuite{suite},
+	})
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(out, "\n")
+	return err
+}
+
+type junitSuites struct {
+	XMLName  xml.Name     `xml:"testsuites"`
+	Name     string       `xml:"name,attr"`
+	Tests    int          `xml:"tests,attr"`
+	Failures int          `xml:"failures,attr"`
+	Errors   int          `xml:"errors,attr"`
+	Skipped  int          `xml:"skipped,attr"`
+	Time     string       `xml:"time,attr"`
+	Suites   []junitSuite `xml:"testsuite"`
+}
+
+type junitSuite struct {
+	Name      string      `xml:"name,attr"`
+	Tests     int         `xml:"tests,attr"`
+	Failures  int         `xml:"failures,attr"`
+	Errors    int         `xml:"errors,attr"`
+	Skipped   int         `xml:"skipped,attr"`
+	Time      string      `xml:"time,attr"`
+	Timestamp string      `xml:"timestamp,attr,omitempty"`
+	Cases     []junitCase `xml:"testcase"`
+}
+
+type junitCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitProblem `xml:"failure"`
+	Error     *junitProblem `xml:"error"`
+	Skipped   *junitProblem `xml:"skipped"`
+	Out       string        `xml:"system-out,omitempty"`
+}
+
+type junitProblem struct {
+	Message string `xml:"message,attr,omitempty"`
+	Body    string `xml:",chardata"`
+}
+
+/*
+Writes the tasks of the given group in the Test Anything Protocol, version 13.
+Each task is a test point, in order of creation. Skipped tasks, including tasks
+that were up to date or resumed, have the "SKIP" directive with the reason.
+Failed and panicked tasks have a YAML block with the error. The output of each
+task, see `Output`, follows its test point as comment lines. Tasks that haven't
+finished are skipped. Should be used after the run is finished.
+
+CLI scripts can use the "--report=tap:<file>" flag of `RunCmd`.
+*/
+func WriteTAP(out io.Writer, group TaskGroup) error {
+	tasks := Snapshot(group)
+
+	var buf strings.Builder
+	fmt.Fprintf(&buf, "TAP version 13\n1..%v\n", len(tasks))
+
+	for ind, val := range tasks {
+		num := ind + 1
+		dur := roundDur(ciDuration(val))
+
+		switch val.Status {
+		case StatusDone:
+			fmt.Fprintf(&buf, "ok %v - %v # time=%v\n", num, val.Task, dur)
+
+		case StatusSkipped, StatusPending, StatusRunning:
+			fmt.Fprintf(&buf, "ok %v - %v # SKIP %v\n", num, val.Task, skipMessage(val))
+
+		default:
+			fmt.Fprintf(&buf, "not ok %v - %v # time=%v\n", num, val.Task, dur)
+			buf.WriteString("  ---\n")
+			fmt.Fprintf(&buf, "  status: %v\n", val.Status)
+			fmt.Fprintf(&buf, "  message: %v\n", strconv.Quote(errMessage(val.Err)))
+			fmt.Fprintf(&buf, "  duration_ms: %v\n", dur.Milliseconds())
+			buf.WriteString("  ...\n")
+		}
+
+		for _, line := range strings.Split(strings.TrimSuffix(val.Output, "\n"), "\n") {
+			if line != "" {
+				fmt.Fprintf(&buf, "# %v\n", line)
+			}
+		}
+	}
+
+	_, err := io.WriteString(out, buf.String())
+	return err
+}
+
+// Running time of a finished task, or zero.
+func ciDuration(val TaskInfo) time.Duration {
+	if val.Started.IsZero() || val.Ended.IsZero() {
+		return 0
+	}
+	return val.Ended.Sub(val.Started)
+}
+
+func seconds(val time.Duration) string {
+	return strconv.FormatFloat(val.Seconds(), 'f', 3, 64)
+}
+
+func errMessage(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
+
+func skipMessage(val TaskInfo) string {
+	if val.Status != StatusSkipped {
+		return `not finished: ` + val.Status.String()
+	}
+	if val.Note != "" {
+		return val.Note
+	}
+	return `skipped`
+}
@@ -0,0 +1,75 @@
+package gtg
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TaskFuncCiPanic(Task) error { panic(fmt.Errorf(`ci panic`)) }
+
+func TaskFuncCiMain(task Task) error {
+	fmt.Fprintln(Output(task), "main output")
+	MustWait(task, Unless(condTrue, TaskFuncNop0))
+	_ = Wait(task, TaskFuncImmediateErr)
+	_ = Wait(task, TaskFuncCiPanic)
+	return nil
+}
+
+func TestWriteJUnit(t *testing.T) {
+	task := Start(context.Background(), TaskFuncCiMain)
+	waitDone(task)
+
+	var buf strings.Builder
+	eq(nil, WriteJUnit(&buf, task))
+	eq(true, strings.HasPrefix(buf.String(), xml.Header+"<testsuites "))
+
+	var out junitSuites
+	eq(nil, xml.Unmarshal([]byte(buf.String()), &out))
+	eq(4, out.Tests)
+	eq(1, out.Failures)
+	eq(1, out.Errors)
+	eq(1, out.Skipped)
+	eq(1, len(out.Suites))
+
+	cases := map[string]junitCase{}
+	for _, val := range out.Suites[0].Cases {
+		cases[val.Name] = val
+	}
+
+	main := cases["TaskFuncCiMain"]
+	eq("main output\n", main.Out)
+	eq((*junitProblem)(nil), main.Failure)
+
+	skipped := cases["Unless(condTrue, TaskFuncNop0)"]
+	eq(true, strings.HasSuffix(skipped.Skipped.Message, "condition condTrue is true"))
+
+	failed := cases["TaskFuncImmediateErr"]
+	eq(true, strings.Contains(failed.Failure.Message, `task "TaskFuncImmediateErr" erred`))
+
+	panicked := cases["TaskFuncCiPanic"]
+	eq(true, strings.Contains(panicked.Error.Message, `ci panic`))
+}
+
+func TestWriteTAP(t *testing.T) {
+	task := Start(context.Background(), TaskFuncCiMain)
+	waitDone(task)
+
+	var buf strings.Builder
+	eq(nil, WriteTAP(&buf, task))
+	lines := strings.Split(buf.String(), "\n")
+
+	eq("TAP version 13", lines[0])
+	eq("1..4", lines[1])
+	eq(true, strings.HasPrefix(lines[2], "ok 1 - TaskFuncCiMain # time="))
+	eq("# main output", lines[3])
+	eq("ok 2 - Unless(condTrue, TaskFuncNop0) # SKIP Unless(condTrue, TaskFuncNop0): condition condTrue is true", lines[4])
+	eq(true, strings.HasPrefix(lines[5], "not ok 3 - TaskFuncImmediateErr # time="))
+	eq("  ---", lines[6])
+	eq("  status: failed", lines[7])
+	eq(true, strings.HasPrefix(lines[8], `  message: "task \"TaskFuncImmediateErr\" erred`))
+	eq(true, strings.Contains(buf.String(), "not ok 4 - TaskFuncCiPanic # time="))
+	eq(true, strings.Contains(buf.String(), "  status: panicked\n"))
+}
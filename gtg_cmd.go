@@ -0,0 +1,141 @@
+package gtg
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+/*
+Options for running an external command as part of a task. The zero value is
+valid and runs the command in the current directory, with the current
+environment, no stdin, and no limit on captured output.
+
+The command is bound to the task's context: when the context is canceled, the
+process is killed.
+*/
+type Cmd struct {
+	// Working directory. Empty means the current directory.
+	Dir string
+
+	// Additional environment variables in "KEY=value" form, appended to the
+	// environment of the current process.
+	Env []string
+
+	// Optional stdin. Takes priority over `StdinFile`.
+	Stdin io.Reader
+
+	// Optional path to a file used as stdin.
+	StdinFile string
+
+	// Maximum number of bytes captured from each of stdout and stderr. Output
+	// beyond the limit is discarded, and `CmdResult.Truncated` is set. Zero
+	// means unlimited.
+	MaxCapture int
+}
+
+/*
+Result of `Cmd.Capture`. Returned even when the command fails, as long as it was
+started.
+*/
+type CmdResult struct {
+	Stdout    []byte
+	Stderr    []byte
+	Code      int
+	Truncated bool
+}
+
+// Returns stdout as a string, with surrounding whitespace removed.
+func (self CmdResult) String() string {
+	return strings.TrimSpace(string(self.Stdout))
+}
+
+// Shortcut for `Cmd{}.Capture()`.
+func Capture(task Task, name string, args ...string) (CmdResult, error) {
+	return Cmd{}.Capture(task, name, args...)
+}
+
+// Shortcut for `Must(Capture())`, returning trimmed stdout.
+func MustCapture(task Task, name string, args ...string) string {
+	res, err := Capture(task, name, args...)
+	Must(err)
+	return res.String()
+}
+
+/*
+Runs an external command bound to the given task, and captures its stdout and
+stderr instead of streaming them. Usage:
+
+	rev, err := Capture(task, "git", "rev-parse", "HEAD")
+
+A non-zero exit status produces an error mentioning the command and the exit
+code, but the result is still returned.
+*/
+func (self Cmd) Capture(task Task, name string, args ...string) (CmdResult, error) {
+	var res CmdResult
+	var stdout, stderr limitBuf
+	stdout.max = self.MaxCapture
+	stderr.max = self.MaxCapture
+
+	cmd := exec.CommandContext(task, name, args...)
+	cmd.Dir = self.Dir
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if len(self.Env) > 0 {
+		cmd.Env = append(os.Environ(), self.Env...)
+	}
+
+	if self.Stdin != nil {
+		cmd.Stdin = self.Stdin
+	} else if self.StdinFile != "" {
+		file, err := os.Open(self.StdinFile)
+		if err != nil {
+			return res, fmt.Errorf(`failed to open stdin for command %q: %w`, name, err)
+		}
+		defer file.Close()
+		cmd.Stdin = file
+	}
+
+	err := cmd.Run()
+
+	res.Stdout = stdout.buf.Bytes()
+	res.Stderr = stderr.buf.Bytes()
+	res.Truncated = stdout.over || stderr.over
+	if cmd.ProcessState != nil {
+		res.Code = cmd.ProcessState.ExitCode()
+	}
+
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return res, fmt.Errorf(`command %q exited with code %v: %w`, name, res.Code, err)
+	}
+	if err != nil {
+		return res, fmt.Errorf(`failed to run command %q: %w`, name, err)
+	}
+	return res, nil
+}
+
+// Buffer that silently discards writes beyond its limit, if any.
+type limitBuf struct {
+	buf  bytes.Buffer
+	max  int
+	over bool
+}
+
+func (self *limitBuf) Write(src []byte) (int, error) {
+	if self.max > 0 {
+		left := self.max - self.buf.Len()
+		if len(src) > left {
+			self.over = true
+			if left > 0 {
+				self.buf.Write(src[:left])
+			}
+			return len(src), nil
+		}
+	}
+	return self.buf.Write(src)
+}
@@ -0,0 +1,74 @@
+package gtg
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCapture(t *testing.T) {
+	t.Run("stdout and exit code", func(t *testing.T) {
+		inside(func(task Task) {
+			res, err := Capture(task, "sh", "-c", "echo hello; echo oops >&2")
+			eq(nil, err)
+			eq("hello", res.String())
+			eq("oops\n", string(res.Stderr))
+			eq(0, res.Code)
+		})
+	})
+
+	t.Run("non-zero exit", func(t *testing.T) {
+		inside(func(task Task) {
+			res, err := Capture(task, "sh", "-c", "echo partial; exit 3")
+			neq(nil, err)
+			eq(true, strings.Contains(err.Error(), "code 3"))
+			eq(3, res.Code)
+			eq("partial", res.String())
+		})
+	})
+
+	t.Run("dir, env, stdin", func(t *testing.T) {
+		dir, err := filepath.EvalSymlinks(t.TempDir())
+		eq(nil, err)
+
+		inside(func(task Task) {
+			res, err := Cmd{
+				Dir:   dir,
+				Env:   []string{"GTG_TEST=val"},
+				Stdin: strings.NewReader("input"),
+			}.Capture(task, "sh", "-c", `pwd; echo $GTG_TEST; cat`)
+			eq(nil, err)
+			eq(dir+"\nval\ninput", res.String())
+		})
+	})
+
+	t.Run("stdin file", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "stdin")
+		eq(nil, os.WriteFile(path, []byte("from file"), os.ModePerm))
+
+		inside(func(task Task) {
+			res, err := Cmd{StdinFile: path}.Capture(task, "cat")
+			eq(nil, err)
+			eq("from file", res.String())
+		})
+	})
+
+	t.Run("max capture", func(t *testing.T) {
+		inside(func(task Task) {
+			res, err := Cmd{MaxCapture: 4}.Capture(task, "sh", "-c", "echo 123456789")
+			eq(nil, err)
+			eq("1234", string(res.Stdout))
+			eq(true, res.Truncated)
+		})
+	})
+}
+
+// Runs the function as a task, using the task's "inside" view.
+func inside(fun func(Task)) {
+	MustRun(context.Background(), func(task Task) error {
+		fun(task)
+		return nil
+	})
+}
@@ -1,17 +1,26 @@
 package gtg
 
 import (
+  "bytes"
   "context"
+  "errors"
+  "flag"
   "fmt"
   "io"
   "os"
   "reflect"
+  "runtime"
   "strings"
   "sync"
+  "sync/atomic"
+  "time"
+  "unsafe"
 )
 
 var logOutput io.Writer = os.Stderr
 
+var stdout io.Writer = os.Stdout
+
 // May be made public when adding a `ChooseMany` function.
 type taskFuncs []TaskFunc
 
@@ -42,102 +51,1159 @@ func (self taskFuncs) byTaskName(name string) TaskFunc {
   return nil
 }
 
-func (self taskFuncs) hasTaskName(name string) bool {
-  return self.byTaskName(name) != nil
-}
-
-func (self taskFuncs) hasTask(val TaskFunc) bool {
-  for _, value := range self {
-    if value.equalTask(val) {
+func (self taskFuncs) hasTaskName(name string) bool {
+  return self.byTaskName(name) != nil
+}
+
+func (self taskFuncs) hasTask(val TaskFunc) bool {
+  for _, value := range self {
+    if value.equalTask(val) {
+      return true
+    }
+  }
+  return false
+}
+
+func (self taskFuncs) shortNames() []string {
+  var out []string
+  for _, value := range self {
+    out = append(out, value.ShortName())
+  }
+  return out
+}
+
+/*
+Not exported because: (1) it's extremely trivial; (2) it could lead to gotchas
+when confused with `Wait`.
+*/
+func waitFor(ctx context.Context) error {
+  <-ctx.Done()
+  return ctx.Err()
+}
+
+/*
+If the waiter is the "inside" view of a task, notifies observers that it's
+waiting on the given tasks. Other waiters, such as task groups or "outside"
+views, are not tasks from our perspective, and are ignored.
+*/
+func waiting(waiter TaskGroup, deps ...Task) func() {
+  inner, ok := waiter.(taskInner)
+  if !ok {
+    return nop
+  }
+  for _, dep := range deps {
+    dep, ok := dep.(*task)
+    if ok {
+      inner.task.addDep(dep)
+      inner.task.emit(Event{Kind: EventWaiting, Task: inner.task.name(), Dep: dep.name(), DepID: dep.id})
+    }
+  }
+
+  start := time.Now()
+  return func() { inner.task.addWaited(time.Since(start)) }
+}
+
+func nop() {}
+
+/*
+Finds or starts a task, like `TaskGroup.Task`. If the group is the "inside" view
+of a task, marks the requested task as awaited before it can fail, which means
+its failure is handled by the waiter; see `Conf.FailFast`. Must be followed by
+waiting on the task.
+*/
+func request(group TaskGroup, fun TaskFunc) Task {
+  inner, ok := group.(taskInner)
+  if ok {
+    return inner.task.taskGroup.start(fun, true)
+  }
+  return group.Task(fun)
+}
+
+// CLI flags supported by `Conf.RunCmd`.
+type cmdFlags struct {
+  summary  bool
+  trace    string
+  failFast bool
+  progress bool
+  dryRun   bool
+  resume   bool
+  graph    string
+  help     bool
+  reports  []string
+  json     string
+}
+
+/*
+Value of the "--json" flag, which may be used with or without a file: "--json"
+means stdout, "--json=<file>" means a file.
+*/
+type jsonFlag struct{ val *string }
+
+func (self jsonFlag) String() string {
+  if self.val == nil {
+    return ""
+  }
+  return *self.val
+}
+
+func (self jsonFlag) Set(val string) error {
+  if val == "true" {
+    val = "-"
+  }
+  if val == "false" {
+    val = ""
+  }
+  *self.val = val
+  return nil
+}
+
+func (self jsonFlag) IsBoolFlag() bool { return true }
+
+/*
+Documentation of a CLI flag supported by `Conf.RunCmd`. The table of these
+flags is the single source for the output of the "--help" flag and for the list
+of flags in the documentation of `RunCmd`, which is checked by a test.
+*/
+type cmdFlagDoc struct {
+  usage string
+  help  string
+
+  // Related declarations, mentioned only in the documentation of `RunCmd`.
+  see string
+}
+
+var cmdFlagDocs = []cmdFlagDoc{
+  {`--summary`, `print timing of all tasks and the critical path afterwards`, "`Conf.Summary`"},
+  {`--trace=<file>`, `write a Chrome trace of all tasks after running`, "`WriteTrace`"},
+  {`--fail-fast`, `cancel all tasks when any task fails`, "`Conf.FailFast`"},
+  {`--progress`, `show running tasks live on a terminal`, "`Progress`"},
+  {`--dry-run`, `print the plan instead of running tasks`, "`Conf.DryRun`"},
+  {`--resume`, `skip tasks that succeeded in the previous run with this flag`, "`Conf.Resume`"},
+  {`--graph=<file>`, `write the graph of declared dependencies instead of running`, "`WriteGraph`"},
+  {`--report=<format>:<file>`, `write a report for CI after running; formats: junit, tap; may be repeated; without a file, writes to stdout`, "`WriteJUnit` and `WriteTAP`"},
+  {`--json[=<file>]`, `write events as newline-delimited JSON to stdout or a file`, "`JSONObserver`"},
+  {`--help`, `list known tasks with declared dependencies, and flags`, ``},
+}
+
+const (
+  cmdFlagUsageWidth = 16
+  cmdFlagHelpWidth  = 60
+)
+
+/*
+Lines of the table of flags, without indentation. If "refs" is true, includes
+related declarations, for the documentation of `RunCmd`.
+*/
+func cmdFlagLines(refs bool) []string {
+  var out []string
+  indent := strings.Repeat(" ", cmdFlagUsageWidth+2)
+
+  for _, val := range cmdFlagDocs {
+    text := val.help
+    if refs && val.see != "" {
+      text += "; see " + val.see
+    }
+    lines := wrapWords(text, cmdFlagHelpWidth)
+
+    if len(val.usage) > cmdFlagUsageWidth {
+      out = append(out, val.usage)
+    } else {
+      out = append(out, fmt.Sprintf(`%-*v  %v`, cmdFlagUsageWidth, val.usage, lines[0]))
+      lines = lines[1:]
+    }
+    for _, line := range lines {
+      out = append(out, indent+line)
+    }
+  }
+  return out
+}
+
+// Splits the text into lines of whole words, each fitting the width if possible.
+func wrapWords(text string, width int) []string {
+  var out []string
+  var line string
+  for _, word := range strings.Fields(text) {
+    if line != "" && len(line)+1+len(word) > width {
+      out = append(out, line)
+      line = ""
+    }
+    if line != "" {
+      line += " "
+    }
+    line += word
+  }
+  return append(out, line)
+}
+
+/*
+Separates CLI flags from task names, and parses the flags. Flags may appear
+anywhere among task names, and flags with values must use the "=" form, such as
+"--trace=file.json".
+*/
+func parseCmdArgs(args []string) (cmdFlags, []string, error) {
+  var out cmdFlags
+  var flags, names []string
+  for _, arg := range args {
+    if strings.HasPrefix(arg, "-") {
+      flags = append(flags, arg)
+    } else {
+      names = append(names, arg)
+    }
+  }
+
+  set := flag.NewFlagSet("gtg", flag.ContinueOnError)
+  set.SetOutput(io.Discard)
+  set.BoolVar(&out.summary, "summary", false, "")
+  set.StringVar(&out.trace, "trace", "", "")
+  set.BoolVar(&out.failFast, "fail-fast", false, "")
+  set.BoolVar(&out.progress, "progress", false, "")
+  set.BoolVar(&out.dryRun, "dry-run", false, "")
+  set.BoolVar(&out.resume, "resume", false, "")
+  set.StringVar(&out.graph, "graph", "", "")
+  set.Func("report", "", func(val string) error {
+    _, _, err := parseReport(val)
+    if err != nil {
+      return err
+    }
+    out.reports = append(out.reports, val)
+    return nil
+  })
+  set.Var(jsonFlag{&out.json}, "json", "")
+  set.BoolVar(&out.help, "help", false, "")
+  set.BoolVar(&out.help, "h", false, "")
+
+  err := set.Parse(flags)
+  return out, names, err
+}
+
+/*
+Lists known tasks with their dependencies declared via `Deps`, followed by the
+supported flags. See `Conf.RunCmd`.
+*/
+func writeHelp(out io.Writer, funs []TaskFunc) error {
+  known, err := dedup(funs)
+  if err != nil {
+    return err
+  }
+
+  width := 0
+  for _, name := range known.shortNames() {
+    if len(name) > width {
+      width = len(name)
+    }
+  }
+
+  var buf strings.Builder
+  buf.WriteString("tasks (case-insensitive):\n")
+  for _, fun := range known {
+    var deps []string
+    for _, dep := range declaredDeps(fun) {
+      deps = append(deps, dep.ShortName())
+    }
+    if len(deps) > 0 {
+      fmt.Fprintf(&buf, "  %-*v  after %v\n", width, fun.ShortName(), strings.Join(deps, ", "))
+    } else {
+      fmt.Fprintf(&buf, "  %v\n", fun.ShortName())
+    }
+  }
+
+  buf.WriteString("\nflags:\n")
+  for _, line := range cmdFlagLines(false) {
+    buf.WriteString("  " + line + "\n")
+  }
+  _, err = io.WriteString(out, buf.String())
+  return err
+}
+
+func writeGraphFile(path string, fun TaskFunc) error {
+  file, err := os.Create(path)
+  if err != nil {
+    return err
+  }
+
+  err = WriteGraph(file, fun)
+  closeErr := file.Close()
+  if err != nil {
+    return err
+  }
+  return closeErr
+}
+
+func addObserver(prev, next Observer) Observer {
+  if prev == nil {
+    return next
+  }
+  return Observers{prev, next}
+}
+
+/*
+Parses the value of the "--report" flag, such as "junit:report.xml", into a
+report writer and an output path. An empty path means stdout.
+*/
+func parseReport(val string) (func(io.Writer, TaskGroup) error, string, error) {
+  format, path, _ := strings.Cut(val, ":")
+  switch format {
+  case "junit":
+    return WriteJUnit, path, nil
+  case "tap":
+    return WriteTAP, path, nil
+  }
+  return nil, "", fmt.Errorf(`unknown report format %q; known formats: "junit", "tap"`, format)
+}
+
+// Resources used for CLI flags. See `Conf.withFlags`.
+type cmdEnv struct {
+  files    []*os.File
+  progress *Progress
+  reports  []cmdReport
+}
+
+// Report requested via the "--report" flag.
+type cmdReport struct {
+  write func(io.Writer, TaskGroup) error
+  out   io.Writer
+}
+
+// Writes the reports requested via flags.
+func (self *cmdEnv) report(main Task) {
+  if main == nil {
+    return
+  }
+  for _, val := range self.reports {
+    Log(val.write(val.out, main))
+  }
+}
+
+// Stops the live display, if any, so that other output doesn't interleave.
+func (self *cmdEnv) stopProgress() {
+  if self.progress != nil {
+    _ = self.progress.Close()
+  }
+}
+
+// Must be called after running.
+func (self *cmdEnv) close() error {
+  self.stopProgress()
+
+  var out error
+  for _, file := range self.files {
+    err := file.Close()
+    if out == nil {
+      out = err
+    }
+  }
+  return out
+}
+
+func (self *cmdEnv) create(path string) (io.Writer, error) {
+  file, err := os.Create(path)
+  if err != nil {
+    return nil, err
+  }
+  self.files = append(self.files, file)
+  return file, nil
+}
+
+/*
+Applies CLI flags to the config, opening output files if necessary. The
+returned environment must be closed after running.
+*/
+func (self Conf) withFlags(flags cmdFlags) (Conf, *cmdEnv, error) {
+  env := new(cmdEnv)
+
+  if flags.summary && self.Summary == nil {
+    self.Summary = logOutput
+  }
+
+  if flags.failFast {
+    self.FailFast = true
+  }
+
+  if flags.dryRun {
+    self.DryRun = true
+  }
+
+  if flags.resume {
+    self.Resume = true
+  }
+
+  if flags.progress {
+    env.progress = NewProgress(logOutput)
+    self.Observer = addObserver(self.Observer, env.progress)
+  }
+
+  if flags.json != "" {
+    out := stdout
+    if flags.json != "-" {
+      var err error
+      out, err = env.create(flags.json)
+      if err != nil {
+        return self, env, err
+      }
+    }
+    self.Observer = addObserver(self.Observer, &JSONObserver{Out: out})
+  }
+
+  if flags.trace != "" {
+    out, err := env.create(flags.trace)
+    if err != nil {
+      return self, env, err
+    }
+    self.Trace = out
+  }
+
+  for _, val := range flags.reports {
+    write, path, err := parseReport(val)
+    if err != nil {
+      return self, env, err
+    }
+
+    var out io.Writer = os.Stdout
+    if path != "" {
+      out, err = env.create(path)
+      if err != nil {
+        return self, env, err
+      }
+    }
+    env.reports = append(env.reports, cmdReport{write, out})
+  }
+
+  return self, env, nil
+}
+
+/*
+Runs the main task of a new group, waiting for it, then for the other tasks,
+as configured by `Conf.Drain`. See `Conf.Run`.
+*/
+func (self Conf) run(ctx context.Context, fun TaskFunc) (Task, error) {
+  ctx, cancel := context.WithCancel(ctx)
+  defer cancel()
+
+  tg := newTaskGroup(ctx, self)
+  if self.Resume {
+    path := self.StateFile
+    if path == "" {
+      path = DefaultStateFile
+    }
+
+    state, err := loadState(path)
+    if err != nil {
+      return nil, fmt.Errorf(`failed to load state for resuming: %w`, err)
+    }
+    tg.state = state
+  }
+
+  main := tg.Task(fun)
+  err := waitFor(main)
+  cancel()
+
+  if self.Drain > 0 {
+    logErr(main, WaitAll(main, self.Drain))
+  }
+
+  if tg.state != nil && !self.DryRun {
+    logErr(main, tg.state.save(err == nil))
+  }
+  return main, err
+}
+
+// Writes the reports requested by the config. See `Conf.Run`.
+func (self Conf) report(main Task) {
+  if main == nil {
+    return
+  }
+  if self.Summary != nil {
+    _, _ = Summarize(main).WriteTo(self.Summary)
+    _, _ = CriticalPath(main).WriteTo(self.Summary)
+  }
+  if self.Trace != nil {
+    Log(WriteTrace(self.Trace, main))
+  }
+}
+
+/*
+Logs an error on behalf of a task, via the group's observer if any, falling
+back on `DefaultObserver`.
+*/
+func logErr(group TaskGroup, err error) {
+  if err == nil {
+    return
+  }
+  obs := DefaultObserver
+  tg := groupOf(group)
+  if tg != nil && tg.conf.Observer != nil {
+    obs = tg.conf.Observer
+  }
+  obs.Observe(Event{Kind: EventError, Time: time.Now(), Err: err})
+}
+
+/*
+Shared implementation of `Race` and `First`. Starts all tasks, and returns the
+first successful one, along with all of them.
+*/
+func first(group TaskGroup, funs []TaskFunc) (Task, []Task, error) {
+  if len(funs) == 0 {
+    return nil, nil, nil
+  }
+
+  wg := makeWaitGroup(len(funs))
+  for _, fun := range funs {
+    wg.add(request(group, fun))
+  }
+  tasks := append([]Task(nil), wg.tasks...)
+
+  defer waiting(group, tasks...)()
+  winner, err := wg.first()
+  return winner, tasks, err
+}
+
+// Cancels the inner context of the task, if it's one of ours.
+func abort(val Task, cause error) {
+  task, ok := val.(*task)
+  if ok {
+    task.cancel(cause)
+  }
+}
+
+func taskName(val Task) string {
+  task, ok := val.(*task)
+  if ok {
+    return task.name()
+  }
+  return ""
+}
+
+// Returns a task with the same group but a different context.
+func withContext(task Task, ctx context.Context) Task {
+  inner, ok := task.(taskInner)
+  if ok {
+    return taskInner{ctx, inner.task}
+  }
+  return struct {
+    context.Context
+    TaskGroup
+  }{ctx, task}
+}
+
+// Result of a task function called on another goroutine. See `callTask`.
+type taskResult struct {
+  err   error
+  panic interface{}
+}
+
+// Returns the error, or repanics on the current goroutine.
+func (self taskResult) get() error {
+  if self.panic != nil {
+    panic(self.panic)
+  }
+  return self.err
+}
+
+/*
+Returns the error, treating a panic with an error value as that error. Repanics
+on the current goroutine if the panic value is not an error.
+*/
+func (self taskResult) getErr() error {
+  err, _ := self.panic.(error)
+  if err != nil {
+    return err
+  }
+  return self.get()
+}
+
+/*
+Calls a task function, capturing a panic instead of letting it crash the
+current goroutine. Used when a task function runs on a goroutine other than the
+one of its task.
+*/
+func callTask(fun TaskFunc, task Task) (out taskResult) {
+  defer func() { out.panic = recover() }()
+  out.err = fun(task)
+  return
+}
+
+// Returns the underlying group of a task or group, if it's one of ours.
+func groupOf(val TaskGroup) *taskGroup {
+  switch val := val.(type) {
+  case *taskGroup:
+    return val
+  case *task:
+    return val.taskGroup
+  case taskInner:
+    return val.task.taskGroup
+  }
+  return nil
+}
+
+// Shared implementation of `If` and `Unless`.
+func conditional(kind string, cond func(Task) bool, expect bool, fun TaskFunc) TaskFunc {
+  condName := funcShortName(funcLongName(cond))
+  name := fmt.Sprintf(`%v(%v, %v)`, kind, condName, fun.ShortName())
+  condID := *(*uintptr)(unsafe.Pointer(&cond))
+
+  return derive(name, []uintptr{condID, fun.id()}, func(task Task) error {
+    if cond(task) == expect {
+      return Wait(task, fun)
+    }
+    skip(task, fmt.Sprintf(`%v: condition %v is %v`, name, condName, !expect))
+    return nil
+  })
+}
+
+/*
+Shared implementation of `Matrix` and `MatrixAll`. If "all" is true, waits for
+every cell, otherwise behaves like `Par`.
+*/
+func matrix(kind string, all bool, cells []TaskFunc) TaskFunc {
+  var ids []uintptr
+  names := make([]string, 0, len(cells))
+  for _, cell := range cells {
+    ids = append(ids, cell.id())
+    names = append(names, cell.ShortName())
+  }
+  name := fmt.Sprintf(`%v(%v)`, kind, strings.Join(names, `, `))
+
+  return derive(name, ids, func(task Task) error {
+    wg := makeWaitGroup(len(cells))
+    for _, cell := range cells {
+      wg.add(request(task, cell))
+    }
+    defer waiting(task, wg.tasks...)()
+
+    if !all {
+      return wg.wait()
+    }
+
+    var errs []error
+    for _, val := range wg.tasks {
+      err := waitFor(val)
+      if err != nil {
+        errs = append(errs, err)
+      }
+    }
+    if len(errs) > 0 {
+      return fmt.Errorf(`%v of %v cells failed: %w`, len(errs), len(cells), errors.Join(errs...))
+    }
+    return nil
+  })
+}
+
+/*
+If the task is the "inside" view of a task, marks it as skipped for the given
+reason: if its function returns without an error, its status is `StatusSkipped`
+rather than `StatusDone`.
+*/
+func skip(task Task, note string) {
+  inner, ok := task.(taskInner)
+  if ok {
+    inner.task.skip(note)
+  }
+}
+
+/*
+Waits for the given duration. Returns false if the task is cancelled first. The
+timer is stopped on return, rather than lingering until the delay expires.
+*/
+func sleep(task Task, delay time.Duration) bool {
+  timer := time.NewTimer(delay)
+  defer timer.Stop()
+
+  select {
+  case <-task.Done():
+    return false
+  case <-timer.C:
+    return true
+  }
+}
+
+// Notifies the group's observer, if the task is one of ours.
+func emit(task Task, val Event) {
+  tg := groupOf(task)
+  if tg != nil {
+    tg.emit(val)
+  }
+}
+
+/*
+Registry of task functions created by combinators; see `derive`. Maps keys,
+which combine names and identities of arguments, to functions, and identities
+of functions to their names. Entries are never removed, which keeps the
+functions alive, guaranteeing that their identities stay unique. The cost is
+that every distinct combination of arguments stays in memory for the lifetime of
+the process; see the note on `If`.
+*/
+var derived struct {
+  lock  sync.Mutex
+  funs  map[string]TaskFunc
+  names map[uintptr]string
+}
+
+/*
+Returns a task function with the given name, identified by the name and the
+given identities. The first call with a given identity creates the function
+from the given one; later calls return the same function, which allows to
+deduplicate it like a statically defined function.
+*/
+func derive(name string, ids []uintptr, fun TaskFunc) TaskFunc {
+  key := fmt.Sprint(name, ids)
+
+  derived.lock.Lock()
+  defer derived.lock.Unlock()
+
+  existing := derived.funs[key]
+  if existing != nil {
+    return existing
+  }
+
+  if derived.funs == nil {
+    derived.funs = map[string]TaskFunc{}
+    derived.names = map[uintptr]string{}
+  }
+  derived.funs[key] = fun
+  derived.names[fun.id()] = name
+  return fun
+}
+
+/*
+Registry of static declarations about task functions, keyed by their
+identities. See `Deps`, `Fresh` and `Inputs`. Like with `derived`, entries are
+never removed, and keep the declared functions alive, so that a function
+created later can't reuse the identity of a declared one, inheriting its
+declarations.
+*/
+var declared struct {
+  lock sync.Mutex
+  funs map[uintptr]*declaration
+}
+
+// Static declarations about one task function. See `declared`.
+type declaration struct {
+  fun    TaskFunc
+  deps   []TaskFunc
+  fresh  func(Task) (bool, error)
+  inputs func(Task) (string, error)
+}
+
+// Modifies the declarations of the given function under lock.
+func declare(fun TaskFunc, update func(*declaration)) {
+  declared.lock.Lock()
+  defer declared.lock.Unlock()
+
+  entry := declared.funs[fun.id()]
+  if entry == nil {
+    if declared.funs == nil {
+      declared.funs = map[uintptr]*declaration{}
+    }
+    entry = &declaration{fun: fun}
+    declared.funs[fun.id()] = entry
+  }
+  update(entry)
+}
+
+// Returns a copy of the declarations of the given function.
+func declarationOf(fun TaskFunc) declaration {
+  declared.lock.Lock()
+  defer declared.lock.Unlock()
+
+  entry := declared.funs[fun.id()]
+  if entry == nil {
+    return declaration{}
+  }
+  return *entry
+}
+
+func declareDeps(fun TaskFunc, deps []TaskFunc) {
+  deps = append([]TaskFunc(nil), deps...)
+  declare(fun, func(entry *declaration) { entry.deps = deps })
+}
+
+func declareFresh(fun TaskFunc, check func(Task) (bool, error)) {
+  declare(fun, func(entry *declaration) { entry.fresh = check })
+}
+
+func declareInputs(fun TaskFunc, hash func(Task) (string, error)) {
+  declare(fun, func(entry *declaration) { entry.inputs = hash })
+}
+
+func declaredDeps(fun TaskFunc) []TaskFunc { return declarationOf(fun).deps }
+
+func declaredFresh(fun TaskFunc) func(Task) (bool, error) { return declarationOf(fun).fresh }
+
+func declaredInputs(fun TaskFunc) func(Task) (string, error) { return declarationOf(fun).inputs }
+
+func derivedName(fun TaskFunc) (string, bool) {
+  derived.lock.Lock()
+  defer derived.lock.Unlock()
+  name, ok := derived.names[fun.id()]
+  return name, ok
+}
+
+func funcLongName(fun interface{}) string {
+  return runtime.FuncForPC(reflect.ValueOf(fun).Pointer()).Name()
+}
+
+/*
+True if the function name, as returned by `funcLongName`, belongs to a closure,
+such as "pkg.Outer.func1", or a method value, such as "pkg.Type.Method-fm".
+*/
+func isClosureName(name string) bool {
+  if strings.HasSuffix(name, "-fm") {
+    return true
+  }
+  rest := strings.TrimPrefix(funcShortName(name), "func")
+  return rest != "" && strings.Trim(rest, "0123456789") == ""
+}
+
+func funcShortName(name string) string {
+  ind := strings.LastIndex(name, ".")
+  if ind >= 0 {
+    return name[ind+1:]
+  }
+  return name
+}
+
+func dedup(funs []TaskFunc) (taskFuncs, error) {
+  var out taskFuncs
+  for _, fun := range funs {
+    err := out.add(fun)
+    if err != nil {
+      return nil, err
+    }
+  }
+  return out, nil
+}
+
+/*
+Task group implementation. Every task is created within a group, and embeds a
+reference to it.
+
+Because a task group has a context, we could easily make it implement `Task` by
+embedding this context. This would allow us to combine `Task` and `TaskGroup`
+into one interface. The reason we don't is because it's unclear what
+constitutes `Done()` and `Err()` for a task group. Should it simply delegate to
+the context, or should it wait for the completion of every task? Should it
+return the error of the first task, or accumulate them all? What about an empty
+task group with no tasks, is it done or not? Clearly just embedding the context
+would not be enough. We already provide `Start()` and `Run()` whose idea of
+`Done()` and `Err()` is tied to the "main" task, which should be enough.
+*/
+type taskGroup struct {
+  ctx       context.Context
+  cancel    context.CancelCauseFunc
+  conf      Conf
+  resources *resourceSet
+  lock      sync.Mutex
+  tasks     map[uintptr]*task
+  list      []*task
+  before    map[uintptr][]TaskFunc
+
+  // See `Provider`.
+  values map[reflect.Type]*groupValue
+
+  // Only when resuming; see `Conf.Resume`.
+  state *stateSet
+
+  // Results of checking declared dependencies for cycles; see `checkDeps`.
+  checked map[uintptr]error
+
+  // Only for subgroups; see `Sub`.
+  parent *taskGroup
+  prefix string
+  shared map[uintptr]bool
+}
+
+func newTaskGroup(ctx context.Context, conf Conf) *taskGroup {
+  out := &taskGroup{ctx: ctx, conf: conf, resources: newResourceSet(conf.Resources)}
+  if conf.FailFast {
+    out.ctx, out.cancel = context.WithCancelCause(ctx)
+  }
+  out.addValues(conf.Values)
+  return out
+}
+
+func (self *taskGroup) addValues(vals []Provider) {
+  self.lock.Lock()
+  defer self.lock.Unlock()
+
+  for _, val := range vals {
+    if val.typ == nil {
+      continue
+    }
+
+    entry := &groupValue{val: val.val, lazy: val.lazy}
+    if val.lazy != nil {
+      entry.fun = providerTask(val.typ)
+    }
+
+    if self.values == nil {
+      self.values = map[reflect.Type]*groupValue{}
+    }
+    self.values[val.typ] = entry
+  }
+}
+
+func (self *taskGroup) ownValue(typ reflect.Type) *groupValue {
+  self.lock.Lock()
+  defer self.lock.Unlock()
+  return self.values[typ]
+}
+
+// Finds a value in this group or its ancestors, returning the owning group.
+func (self *taskGroup) value(typ reflect.Type) (*taskGroup, *groupValue) {
+  for group := self; group != nil; group = group.parent {
+    entry := group.ownValue(typ)
+    if entry != nil {
+      return group, entry
+    }
+  }
+  return nil, nil
+}
+
+func (self *taskGroup) Task(fun TaskFunc) Task {
+  return self.start(fun, false)
+}
+
+/*
+Finds or starts a task. If "awaited" is true, marks the task as awaited before
+starting it; see `request`.
+*/
+func (self *taskGroup) start(fun TaskFunc, awaited bool) *task {
+  if self.shared[fun.id()] {
+    return self.parent.start(fun, awaited)
+  }
+
+  task, created := self.task(fun)
+  if awaited {
+    task.setAwaited()
+  }
+  if created {
+    task.emit(Event{Kind: EventCreated, Task: task.name()})
+    go task.run()
+  }
+  return task
+}
+
+// Finds or creates a task. The caller must start a created task.
+func (self *taskGroup) task(fun TaskFunc) (*task, bool) {
+  self.lock.Lock()
+  defer self.lock.Unlock()
+
+  id := fun.id()
+  existing := self.tasks[id]
+  if existing != nil {
+    return existing, false
+  }
+
+  if self.tasks == nil {
+    self.tasks = map[uintptr]*task{}
+  }
+
+  created := newTask(self.ctx, self, fun)
+  self.tasks[id] = created
+  self.list = append(self.list, created)
+  if self.parent != nil {
+    self.parent.track(created)
+  }
+  return created, true
+}
+
+// Includes a task of a subgroup in the list of this group and its ancestors.
+func (self *taskGroup) track(task *task) {
+  self.lock.Lock()
+  self.list = append(self.list, task)
+  self.lock.Unlock()
+
+  if self.parent != nil {
+    self.parent.track(task)
+  }
+}
+
+// See `Sub`.
+func (self *taskGroup) sub(name string, shared []TaskFunc) *taskGroup {
+  out := newTaskGroup(self.ctx, self.conf)
+  out.resources = self.resources
+  out.state = self.state
+  out.values = nil
+  out.parent = self
+  out.prefix = self.prefix + name + "/"
+  for _, fun := range shared {
+    if out.shared == nil {
+      out.shared = map[uintptr]bool{}
+    }
+    out.shared[fun.id()] = true
+  }
+  return out
+}
+
+/*
+Registers ordering constraints between consecutive functions; see `Order`.
+Fails if a task has already started without honoring a new constraint, or if a
+new constraint would close a cycle.
+*/
+func (self *taskGroup) order(funs []TaskFunc) error {
+  self.lock.Lock()
+  defer self.lock.Unlock()
+
+  for ind := 1; ind < len(funs); ind++ {
+    prev, next := funs[ind-1], funs[ind]
+    if self.hasPrereq(next, prev) {
+      continue
+    }
+
+    path := self.prereqPath(prev, next)
+    if path != nil {
+      names := []string{next.ShortName()}
+      for _, val := range path {
+        names = append(names, val.ShortName())
+      }
+      return fmt.Errorf(`ordering cycle: %v`, strings.Join(names, " -> "))
+    }
+
+    nextTask := self.tasks[next.id()]
+    if nextTask != nil && !nextTask.startedAfter(self.tasks[prev.id()]) {
+      return fmt.Errorf(`can't order task %q after %q: it was started first`, next.ShortName(), prev.ShortName())
+    }
+
+    if self.before == nil {
+      self.before = map[uintptr][]TaskFunc{}
+    }
+    self.before[next.id()] = append(self.before[next.id()], prev)
+  }
+  return nil
+}
+
+// Must be called under lock.
+func (self *taskGroup) hasPrereq(fun, prereq TaskFunc) bool {
+  for _, val := range self.before[fun.id()] {
+    if val.equal(prereq) {
       return true
     }
   }
   return false
 }
 
-func (self taskFuncs) shortNames() []string {
-  var out []string
-  for _, value := range self {
-    out = append(out, value.ShortName())
-  }
-  return out
-}
-
 /*
-Not exported because: (1) it's extremely trivial; (2) it could lead to gotchas
-when confused with `Wait`.
+If the task of "fun" transitively waits on the task of "prereq" due to ordering
+constraints, returns the chain from one to the other, inclusive. Otherwise
+returns nil. Must be called under lock.
 */
-func waitFor(ctx context.Context) error {
-  <-ctx.Done()
-  return ctx.Err()
-}
+func (self *taskGroup) prereqPath(fun, prereq TaskFunc) []TaskFunc {
+  seen := map[uintptr]bool{}
 
-func funcShortName(name string) string {
-  ind := strings.LastIndex(name, ".")
-  if ind >= 0 {
-    return name[ind+1:]
-  }
-  return name
-}
+  var walk func(TaskFunc) []TaskFunc
+  walk = func(fun TaskFunc) []TaskFunc {
+    if fun.equal(prereq) {
+      return []TaskFunc{fun}
+    }
+    if seen[fun.id()] {
+      return nil
+    }
+    seen[fun.id()] = true
 
-func dedup(funs []TaskFunc) (taskFuncs, error) {
-  var out taskFuncs
-  for _, fun := range funs {
-    err := out.add(fun)
-    if err != nil {
-      return nil, err
+    for _, val := range self.before[fun.id()] {
+      path := walk(val)
+      if path != nil {
+        return append([]TaskFunc{fun}, path...)
+      }
     }
+    return nil
   }
-  return out, nil
+  return walk(fun)
+}
+
+// Functions whose tasks must finish before the task of this function starts.
+func (self *taskGroup) prereqs(fun TaskFunc) []TaskFunc {
+  self.lock.Lock()
+  defer self.lock.Unlock()
+  return append([]TaskFunc(nil), self.before[fun.id()]...)
 }
 
 /*
-Task group implementation. Every task is created within a group, and embeds a
-reference to it.
+Called when a task fails. See `Conf.FailFast`. If another task waits on the
+failed one, the failure is up to the waiter, which either handles it, as `Opt`
+and `Fallback` do, or fails too, eventually reaching a task that nothing waits
+on, such as the main task.
+*/
+func (self *taskGroup) failed(task *task) {
+  if self.cancel != nil && !task.isAwaited() {
+    self.cancel(task.Err())
+  }
+}
 
-Because a task group has a context, we could easily make it implement `Task` by
-embedding this context. This would allow us to combine `Task` and `TaskGroup`
-into one interface. The reason we don't is because it's unclear what
-constitutes `Done()` and `Err()` for a task group. Should it simply delegate to
-the context, or should it wait for the completion of every task? Should it
-return the error of the first task, or accumulate them all? What about an empty
-task group with no tasks, is it done or not? Clearly just embedding the context
-would not be enough. We already provide `Start()` and `Run()` whose idea of
-`Done()` and `Err()` is tied to the "main" task, which should be enough.
+/*
+Checks the dependencies of the function declared via `Deps` for cycles. Each
+function is checked at most once per group: a successful check also covers
+every function it reached.
 */
-type taskGroup struct {
-  ctx   context.Context
-  lock  sync.Mutex
-  tasks map[uintptr]*task
+func (self *taskGroup) checkDeps(fun TaskFunc) error {
+  self.lock.Lock()
+  err, ok := self.checked[fun.id()]
+  self.lock.Unlock()
+  if ok {
+    return err
+  }
+
+  list, err := walkDeps([]TaskFunc{fun})
+
+  self.lock.Lock()
+  defer self.lock.Unlock()
+  if self.checked == nil {
+    self.checked = map[uintptr]error{}
+  }
+  for _, val := range list {
+    self.checked[val.id()] = nil
+  }
+  self.checked[fun.id()] = err
+  return err
 }
 
-func (self *taskGroup) Task(fun TaskFunc) Task {
+// Returns all tasks in the group, in order of creation.
+func (self *taskGroup) all() []*task {
   self.lock.Lock()
   defer self.lock.Unlock()
+  return append([]*task(nil), self.list...)
+}
 
-  id := fun.id()
-  existing := self.tasks[id]
-  if existing != nil {
-    return existing
+// Error for `WaitAll`, naming the tasks that haven't finished.
+func (self *taskGroup) stillRunning(timeout time.Duration) error {
+  var names []string
+  for _, task := range self.all() {
+    if !isDone(task) {
+      names = append(names, fmt.Sprintf(`%q`, task.name()))
+    }
   }
+  return fmt.Errorf(`%v tasks still running after %v: %v`, len(names), timeout, strings.Join(names, ", "))
+}
 
-  if self.tasks == nil {
-    self.tasks = map[uintptr]*task{}
+// Notifies the observer, if any. Sets the event time if missing.
+func (self *taskGroup) emit(val Event) {
+  obs := self.conf.Observer
+  if obs == nil {
+    return
   }
-
-  created := newTask(self.ctx, self, fun)
-  self.tasks[id] = created
-
-  go created.run()
-  return created
+  if val.Time.IsZero() {
+    val.Time = time.Now()
+  }
+  obs.Observe(val)
 }
 
+// Source of `task.id`.
+var lastTaskID uint64
+
 func newTask(ctx context.Context, group *taskGroup, fun TaskFunc) *task {
+  // Only a zero-value group may have a nil context.
+  if ctx == nil {
+    ctx = context.Background()
+  }
+  ctx, cancel := context.WithCancelCause(ctx)
   return &task{
+    id:        atomic.AddUint64(&lastTaskID, 1),
     ctx:       ctx,
+    cancel:    cancel,
     taskGroup: group,
     fun:       fun,
     done:      make(chan struct{}),
+    created:   time.Now(),
   }
 }
 
@@ -148,16 +1214,47 @@ type ctx = context.Context
 type task struct {
   ctx
   *taskGroup
-  fun     TaskFunc
-  done    chan struct{}
-  errLock sync.Mutex
-  err     error
+  id        uint64
+  cancel    context.CancelCauseFunc
+  fun       TaskFunc
+  done      chan struct{}
+  stateLock sync.Mutex
+  status    Status
+  skipped   bool
+  awaited   bool
+  note      string
+  worked    bool
+  hash      string
+  err       error
+  created   time.Time
+  start     time.Time
+  end       time.Time
+  waited    time.Duration
+  deps      []*task
+  attempts  int
+  output    []byte
+  flushed   int
+}
+
+/*
+A view of the task from the "inside", passed to its function. Its context is a
+normal `context.Context`. Unlike the "outside" view, it knows which task it
+belongs to, which allows to track which tasks wait on which.
+*/
+type taskInner struct {
+  ctx
+  task *task
+}
+
+// Implement `TaskGroup`.
+func (self taskInner) Task(fun TaskFunc) Task {
+  return self.task.taskGroup.Task(fun)
 }
 
 // Override `context.Context.Err()`.
 func (self *task) Err() error {
-  self.errLock.Lock()
-  defer self.errLock.Unlock()
+  self.stateLock.Lock()
+  defer self.stateLock.Unlock()
   return self.err
 }
 
@@ -166,51 +1263,463 @@ func (self *task) Done() <-chan struct{} {
   return self.done
 }
 
+func (self *task) name() string {
+  return self.prefix + self.fun.ShortName()
+}
+
+// Notifies the group's observer about this task.
+func (self *task) emit(val Event) {
+  val.TaskID = self.id
+  self.taskGroup.emit(val)
+}
+
 // Must be called exactly once.
 func (self *task) run() {
   defer self.finalize()
 
-  // A view of the task from the "inside".
-  err := self.fun(struct {
-    ctx
-    *taskGroup
-  }{
-    self.ctx,
-    self.taskGroup,
-  })
+  err := self.awaitPrereqs()
+  if err == nil {
+    err = self.runBody()
+  }
 
-  self.errLock.Lock()
-  defer self.errLock.Unlock()
+  self.stateLock.Lock()
+  defer self.stateLock.Unlock()
   self.err = err
 }
 
+// The task function with the group's middleware applied; see `Middleware`.
+func (self *task) wrapped() TaskFunc {
+  fun := self.fun
+  name := self.name()
+  list := self.taskGroup.conf.Middleware
+  for ind := len(list) - 1; ind >= 0; ind-- {
+    if list[ind] != nil {
+      fun = list[ind](name, fun)
+    }
+  }
+  return fun
+}
+
+/*
+Runs the task function, unless the task is up to date or the group is in a dry
+run; see `Fresh` and `Conf.DryRun`.
+*/
+func (self *task) runBody() error {
+  dry := self.taskGroup.conf.DryRun
+
+  resumed, err := self.resumed()
+  if err != nil {
+    return err
+  }
+  if resumed {
+    msg := `succeeded in previous run`
+    if dry {
+      msg = `would skip: succeeded in previous run`
+    }
+    self.skip(msg)
+    return nil
+  }
+
+  fresh, err := self.fresh()
+  if err != nil {
+    return err
+  }
+
+  if fresh {
+    msg := `up to date`
+    if dry {
+      msg = `would skip: up to date`
+    }
+    self.skip(msg)
+    return nil
+  }
+
+  if dry {
+    self.skip(`would run`)
+    self.setWorked()
+    return nil
+  }
+
+  self.begin()
+  return self.wrapped()(taskInner{self.ctx, self})
+}
+
+/*
+When resuming, hashes the task's inputs, and returns true if it succeeded in the
+previous run with the same hash. See `Conf.Resume` and `Inputs`.
+*/
+func (self *task) resumed() (bool, error) {
+  state := self.taskGroup.state
+  if state == nil {
+    return false, nil
+  }
+
+  key, ok := self.stateKey()
+  if !ok {
+    return false, nil
+  }
+
+  var hash string
+  fun := declaredInputs(self.fun)
+  if fun != nil {
+    var err error
+    hash, err = fun(taskInner{self.ctx, self})
+    if err != nil {
+      return false, fmt.Errorf(`failed to hash inputs: %w`, err)
+    }
+  }
+
+  self.stateLock.Lock()
+  self.hash = hash
+  self.stateLock.Unlock()
+  return state.succeeded(key, hash), nil
+}
+
+/*
+Identifies the task in the state file; see `Conf.Resume`. Unlike the task name,
+includes the package path, which makes it unique within a program. False for
+closures and method values, including functions created by `Ser`, `Par`, `Opt`,
+`Timeout` and `Retry`: many of them may share one name, so they're neither
+recorded nor skipped.
+*/
+func (self *task) stateKey() (string, bool) {
+  name, ok := derivedName(self.fun)
+  if ok {
+    return self.prefix + name, true
+  }
+
+  name = funcLongName(self.fun)
+  if isClosureName(name) {
+    return "", false
+  }
+  return self.prefix + name, true
+}
+
+/*
+True if the task has a freshness check that reports it as up to date, and none
+of its prerequisites did any work. See `Fresh`.
+*/
+func (self *task) fresh() (bool, error) {
+  check := declaredFresh(self.fun)
+  if check == nil {
+    return false, nil
+  }
+  for _, dep := range self.depList() {
+    if dep.didWork() {
+      return false, nil
+    }
+  }
+
+  fresh, err := check(taskInner{self.ctx, self})
+  if err != nil {
+    return false, fmt.Errorf(`failed to check if up to date: %w`, err)
+  }
+  return fresh, nil
+}
+
+func (self *task) begin() {
+  start := time.Now()
+  self.stateLock.Lock()
+  self.start = start
+  self.status = StatusRunning
+  self.attempts = 1
+  self.worked = true
+  self.stateLock.Unlock()
+  self.emit(Event{Kind: EventStarted, Time: start, Task: self.name()})
+}
+
+func (self *task) skip(note string) {
+  self.stateLock.Lock()
+  defer self.stateLock.Unlock()
+  self.skipped = true
+  self.worked = false
+  self.note = note
+}
+
+func (self *task) setWorked() {
+  self.stateLock.Lock()
+  defer self.stateLock.Unlock()
+  self.worked = true
+}
+
+/*
+True if the task ran its function, or would run it in a dry run, as opposed to
+being skipped.
+*/
+func (self *task) didWork() bool {
+  self.stateLock.Lock()
+  defer self.stateLock.Unlock()
+  return self.worked
+}
+
+/*
+Waits on the tasks that must finish before this one starts: dependencies
+declared via `Deps`, which are started together, and tasks ordered before this
+one via `Order`. This happens before the task starts, so the time counts as
+queued rather than waiting.
+*/
+func (self *task) awaitPrereqs() error {
+  err := self.taskGroup.checkDeps(self.fun)
+  if err != nil {
+    return err
+  }
+
+  var deps []*task
+  for _, fun := range declaredDeps(self.fun) {
+    deps = append(deps, self.taskGroup.start(fun, true))
+  }
+
+  for _, fun := range self.taskGroup.prereqs(self.fun) {
+    deps = append(deps, self.taskGroup.start(fun, true))
+  }
+
+  for _, dep := range deps {
+    self.addDep(dep)
+    self.emit(Event{Kind: EventWaiting, Task: self.name(), Dep: dep.name(), DepID: dep.id})
+
+    err := waitFor(dep)
+    if err != nil {
+      return fmt.Errorf(`prerequisite failed: %w`, err)
+    }
+  }
+  return nil
+}
+
+/*
+True if this task started after the other task had finished. A task that hasn't
+started, for example because it's waiting on its own prerequisites, may start at
+any moment, and doesn't count.
+*/
+func (self *task) startedAfter(other *task) bool {
+  if other == nil {
+    return false
+  }
+  _, _, otherEnd := other.times()
+  _, start, _ := self.times()
+  return isDone(other) && !start.IsZero() && !start.Before(otherEnd)
+}
+
+func isDone(ctx context.Context) bool {
+  select {
+  case <-ctx.Done():
+    return true
+  default:
+    return false
+  }
+}
+
+// Records that this task waited on another. Duplicates are ignored.
+func (self *task) addDep(dep *task) {
+  self.stateLock.Lock()
+  defer self.stateLock.Unlock()
+  for _, val := range self.deps {
+    if val == dep {
+      return
+    }
+  }
+  self.deps = append(self.deps, dep)
+}
+
+// Tasks this task waited on, in order of waiting.
+func (self *task) depList() []*task {
+  self.stateLock.Lock()
+  defer self.stateLock.Unlock()
+  return append([]*task(nil), self.deps...)
+}
+
+func (self *task) setAwaited() {
+  self.stateLock.Lock()
+  defer self.stateLock.Unlock()
+  self.awaited = true
+}
+
+// True if another task waited on this one. See `taskGroup.failed`.
+func (self *task) isAwaited() bool {
+  self.stateLock.Lock()
+  defer self.stateLock.Unlock()
+  return self.awaited
+}
+
+func (self *task) setAttempts(val int) {
+  self.stateLock.Lock()
+  defer self.stateLock.Unlock()
+  self.attempts = val
+}
+
+/*
+Maximum size of the output kept by a task; see `Output`. The output may grow up
+to twice this size before older lines are dropped.
+*/
+const maxTaskOutput = 1 << 20
+
+/*
+Appends to the task's output, reporting each complete line as `EventOutput`.
+Keeps only the last `maxTaskOutput` bytes. See `Output`.
+*/
+func (self *task) write(val []byte) {
+  self.stateLock.Lock()
+  self.output = append(self.output, val...)
+  lines := self.lines(false)
+  if len(self.output) > 2*maxTaskOutput {
+    drop := len(self.output) - maxTaskOutput
+    self.output = append([]byte(nil), self.output[drop:]...)
+    self.flushed -= drop
+  }
+  self.stateLock.Unlock()
+
+  for _, line := range lines {
+    self.emit(Event{Kind: EventOutput, Task: self.name(), Msg: line})
+  }
+}
+
+/*
+Returns lines of output not yet reported, and marks them as reported. Unless
+"all" is true, ignores the incomplete last line, unless it exceeds
+`maxTaskOutput`. Must be called under lock.
+*/
+func (self *task) lines(all bool) []string {
+  var out []string
+  for {
+    rest := self.output[self.flushed:]
+    ind := bytes.IndexByte(rest, '\n')
+    if ind < 0 {
+      if (all || len(rest) > maxTaskOutput) && len(rest) > 0 {
+        out = append(out, string(rest))
+        self.flushed = len(self.output)
+      }
+      return out
+    }
+    out = append(out, string(bytes.TrimSuffix(rest[:ind], []byte("\r"))))
+    self.flushed += ind + 1
+  }
+}
+
+func (self *task) addWaited(dur time.Duration) {
+  self.stateLock.Lock()
+  defer self.stateLock.Unlock()
+  self.waited += dur
+}
+
 /*
 Must be deferred:
 
   defer self.finalize()
-
-Known issue: `fmt.Errorf` obscures stacktraces in errors generated by 3rd party
-error packages.
 */
 func (self *task) finalize() {
+  defer self.cancel(nil)
   defer close(self.done)
+  val := recover()
+
+  self.stateLock.Lock()
+  self.end = time.Now()
+  if self.start.IsZero() {
+    self.start = self.end
+  }
+  kind := EventFinished
+  self.status = StatusDone
+  if self.skipped {
+    kind = EventSkipped
+    if self.worked {
+      kind = EventPlanned
+    }
+    self.status = StatusSkipped
+  }
 
   if self.err != nil {
-    self.err = fmt.Errorf(`task %q erred: %w`, self.fun.ShortName(), self.err)
-    return
+    self.err = &TaskError{Task: self.name(), Err: self.err, Attempts: self.attempts}
+    kind = EventFailed
+    self.status = StatusFailed
+  } else if val != nil {
+    err, _ := val.(error)
+    if err == nil {
+      err = fmt.Errorf(`non-error value %#v`, val)
+    }
+    self.err = &TaskError{Task: self.name(), Err: err, Panicked: true, Attempts: self.attempts}
+    kind = EventPanicked
+    self.status = StatusPanicked
   }
 
-  val := recover()
+  event := Event{Kind: kind, Time: self.end, Task: self.name(), Duration: self.end.Sub(self.start), Err: self.err}
+  if kind == EventSkipped || kind == EventPlanned {
+    event.Msg = self.note
+  }
+  lines := self.lines(true)
+  hash := self.hash
+  self.stateLock.Unlock()
 
-  err, _ := val.(error)
-  if err != nil {
-    self.err = fmt.Errorf(`task %q panicked: %w`, self.fun.ShortName(), err)
-    return
+  state := self.taskGroup.state
+  key, ok := self.stateKey()
+  if state != nil && ok && !self.taskGroup.conf.DryRun {
+    state.record(key, hash, event.Err == nil)
+  }
+
+  for _, line := range lines {
+    self.emit(Event{Kind: EventOutput, Task: self.name(), Msg: line})
+  }
+  self.emit(event)
+  if event.Err != nil {
+    self.taskGroup.failed(self)
+  }
+}
+
+/*
+Creation, start and end time. The start time is zero if the task hasn't
+started. The end time is the current time if the task hasn't finished.
+*/
+func (self *task) times() (time.Time, time.Time, time.Time) {
+  self.stateLock.Lock()
+  defer self.stateLock.Unlock()
+  if self.end.IsZero() {
+    return self.created, self.start, time.Now()
+  }
+  return self.created, self.start, self.end
+}
+
+// Consistent copy of the task's state; see `Inspect`.
+func (self *task) info() TaskInfo {
+  deps := self.depList()
+
+  self.stateLock.Lock()
+  defer self.stateLock.Unlock()
+
+  out := TaskInfo{
+    Task:     self.name(),
+    Status:   self.status,
+    Created:  self.created,
+    Started:  self.start,
+    Ended:    self.end,
+    Attempts: self.attempts,
+    Err:      self.err,
+    Note:     self.note,
+    Output:   string(self.output),
+  }
+  for _, dep := range deps {
+    out.Deps = append(out.Deps, dep.name())
+  }
+  return out
+}
+
+// Consistent copy of the task's timing and status.
+func (self *task) summary() TaskSummary {
+  self.stateLock.Lock()
+  defer self.stateLock.Unlock()
+
+  out := TaskSummary{
+    Task:    self.name(),
+    Status:  self.status,
+    Waiting: self.waited,
+    Err:     self.err,
   }
 
-  if val != nil {
-    self.err = fmt.Errorf(`task %q panicked with non-error value %#v`, self.fun.ShortName(), val)
+  if !self.start.IsZero() {
+    out.Queued = self.start.Sub(self.created)
+    end := self.end
+    if end.IsZero() {
+      end = time.Now()
+    }
+    out.Running = end.Sub(self.start)
   }
+  return out
 }
 
 /*
@@ -258,6 +1767,24 @@ func (self *waitGroup) wait() error {
   return nil
 }
 
+/*
+Returns the first task that finishes successfully. If every task fails, returns
+all their errors, joined.
+*/
+func (self *waitGroup) first() (Task, error) {
+  var errs []error
+  for len(self.cases) > 0 {
+    index, _, _ := reflect.Select(self.cases)
+    task := self.remove(index)
+    err := task.Err()
+    if err == nil {
+      return task, nil
+    }
+    errs = append(errs, err)
+  }
+  return nil, errors.Join(errs...)
+}
+
 func (self *waitGroup) remove(index int) Task {
   task := self.tasks[index]
 
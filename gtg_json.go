@@ -0,0 +1,112 @@
+package gtg
+
+import (
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+)
+
+/*
+Version of the JSON schema of events, written by `JSONObserver` and
+`Event.MarshalJSON`. Changes only when existing fields are removed or change
+meaning; new fields may be added without changing the version.
+
+Each event is an object with the following fields. Fields other than "v",
+"time" and "kind" are omitted when empty.
+
+	v            number    schema version, currently 1
+	time         string    RFC 3339 timestamp with nanoseconds
+	kind         string    see `EventKind`: "created", "started", "waiting",
+	                       "finished", "failed", "panicked", "skipped",
+	                       "planned", "retrying", "blocked", "fallback",
+	                       "output", "error"
+	task         string    short name of the task
+	task_id      number    identity of the task, unique within the process;
+	                       tells apart tasks with the same name, such as
+	                       closures named "func1"
+	dep          string    task being waited on, for "waiting" and "fallback"
+	dep_id       number    identity of the task being waited on, for
+	                       "waiting"
+	resource     string    resource being waited on, for "blocked"
+	duration_ns  number    running time, or delay before the next attempt
+	attempt      number    number of the failed attempt, for "retrying"
+	error        string    error message
+	msg          string    details, or a line of output for "output"
+
+The "waiting" events are the edges of the task graph. Consumers should identify
+tasks by "task_id" and "dep_id" rather than by name.
+*/
+const EventSchemaVersion = 1
+
+type eventJSON struct {
+	V          int    `json:"v"`
+	Time       string `json:"time"`
+	Kind       string `json:"kind"`
+	Task       string `json:"task,omitempty"`
+	TaskID     uint64 `json:"task_id,omitempty"`
+	Dep        string `json:"dep,omitempty"`
+	DepID      uint64 `json:"dep_id,omitempty"`
+	Resource   string `json:"resource,omitempty"`
+	DurationNs int64  `json:"duration_ns,omitempty"`
+	Attempt    int    `json:"attempt,omitempty"`
+	Error      string `json:"error,omitempty"`
+	Msg        string `json:"msg,omitempty"`
+}
+
+// Implement `json.Marshaler`. See `EventSchemaVersion` for the schema.
+func (self Event) MarshalJSON() ([]byte, error) {
+	return json.Marshal(eventJSON{
+		V:          EventSchemaVersion,
+		Time:       self.Time.UTC().Format(time.RFC3339Nano),
+		Kind:       string(self.Kind),
+		Task:       self.Task,
+		TaskID:     self.TaskID,
+		Dep:        self.Dep,
+		DepID:      self.DepID,
+		Resource:   self.Resource,
+		DurationNs: int64(self.Duration),
+		Attempt:    self.Attempt,
+		Error:      errMessage(self.Err),
+		Msg:        self.Msg,
+	})
+}
+
+/*
+Observer that writes events as newline-delimited JSON, one object per line, for
+other tools to consume. See `EventSchemaVersion` for the schema. Must be used
+by pointer:
+
+	conf := Conf{Observer: &JSONObserver{Out: os.Stdout}}
+
+CLI scripts can use the "--json" flag of `RunCmd`, which writes to stdout, or
+"--json=<file>".
+*/
+type JSONObserver struct {
+	// Where to write. Nil means stdout.
+	Out io.Writer
+
+	lock sync.Mutex
+}
+
+// Implement `Observer`.
+func (self *JSONObserver) Observe(val Event) {
+	if val.Time.IsZero() {
+		val.Time = time.Now()
+	}
+
+	body, err := json.Marshal(val)
+	if err != nil {
+		return
+	}
+	body = append(body, '\n')
+
+	self.lock.Lock()
+	defer self.lock.Unlock()
+
+	out := self.Out
+	if out == nil {
+		out = stdout
+	}
+	_, _ = out.Write(body)
+}
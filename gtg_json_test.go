@@ -0,0 +1,97 @@
+package gtg
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestEventMarshalJSON(t *testing.T) {
+	val := Event{
+		Kind:     EventFailed,
+		Time:     time.Date(2020, 1, 2, 3, 4, 5, 6, time.UTC),
+		Task:     "Build",
+		TaskID:   3,
+		Duration: time.Millisecond,
+		Err:      errors.New(`some error`),
+	}
+
+	body, err := json.Marshal(val)
+	eq(nil, err)
+	eq(`{"v":1,"time":"2020-01-02T03:04:05.000000006Z","kind":"failed","task":"Build","task_id":3,"duration_ns":1000000,"error":"some error"}`, string(body))
+}
+
+func TestJSONObserver(t *testing.T) {
+	events := jsonEvents(TaskFuncCiMain)
+
+	has := func(expected eventJSON) bool {
+		for _, val := range events {
+			val.Time, val.DurationNs, val.TaskID, val.DepID = "", 0, 0, 0
+			if val == expected {
+				return true
+			}
+		}
+		return false
+	}
+
+	eq(true, has(eventJSON{V: 1, Kind: "started", Task: "TaskFuncCiMain"}))
+	eq(true, has(eventJSON{V: 1, Kind: "output", Task: "TaskFuncCiMain", Msg: "main output"}))
+	eq(true, has(eventJSON{V: 1, Kind: "waiting", Task: "TaskFuncCiMain", Dep: "TaskFuncImmediateErr"}))
+	eq(true, has(eventJSON{V: 1, Kind: "failed", Task: "TaskFuncImmediateErr", Error: `task "TaskFuncImmediateErr" erred: immediate error`}))
+	eq(true, has(eventJSON{V: 1, Kind: "finished", Task: "TaskFuncCiMain"}))
+}
+
+func TestJSONObserverTaskIDs(t *testing.T) {
+	closure := func(text string) TaskFunc {
+		return func(task Task) error {
+			_, err := Output(task).Write([]byte(text + "\n"))
+			return err
+		}
+	}
+	one, two := closure("one"), closure("two")
+	eq(one.ShortName(), two.ShortName())
+
+	events := jsonEvents(Par(one, two))
+
+	ids := map[string]uint64{}
+	var waited []uint64
+	for _, val := range events {
+		neq(uint64(0), val.TaskID)
+		if val.Kind == "output" {
+			ids[val.Msg] = val.TaskID
+		}
+		if val.Kind == "waiting" {
+			waited = append(waited, val.DepID)
+		}
+	}
+
+	eq(2, len(ids))
+	neq(ids["one"], ids["two"])
+	eq(2, len(waited))
+	eq(true, slices.Contains(waited, ids["one"]))
+	eq(true, slices.Contains(waited, ids["two"]))
+}
+
+// Runs the task with a `JSONObserver`, and decodes the events it wrote.
+func jsonEvents(fun TaskFunc) []eventJSON {
+	var buf bytes.Buffer
+	task := Conf{Observer: &JSONObserver{Out: &buf}}.Start(context.Background(), fun)
+	waitDone(task)
+
+	var out []eventJSON
+	scanner := bufio.NewScanner(&buf)
+	for scanner.Scan() {
+		var val eventJSON
+		eq(nil, json.Unmarshal(scanner.Bytes(), &val))
+		eq(EventSchemaVersion, val.V)
+		_, err := time.Parse(time.RFC3339Nano, val.Time)
+		eq(nil, err)
+		out = append(out, val)
+	}
+	return out
+}
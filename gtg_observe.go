@@ -0,0 +1,263 @@
+package gtg
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"time"
+)
+
+/*
+Receives events about tasks in a group; see `Conf.Observer`. Also used by
+package-level CLI helpers such as `Log` and `Timing`; see `DefaultObserver`.
+
+Events may be delivered concurrently from multiple goroutines. Implementations
+must be safe for concurrent use, and should return quickly.
+*/
+type Observer interface {
+	Observe(Event)
+}
+
+/*
+Observer used by `Log`, `Timing`, `TaskTiming`, and by task groups without their
+own observer when logging errors of `Opt` tasks. Apps may replace it to route
+Gtg's output to their own logger. Should be set before running any tasks.
+*/
+var DefaultObserver Observer = Logger{}
+
+// Function adapter for the `Observer` interface.
+type ObserverFunc func(Event)
+
+// Implement `Observer`.
+func (self ObserverFunc) Observe(val Event) {
+	if self != nil {
+		self(val)
+	}
+}
+
+// Combines multiple observers, notifying them in order. Nil entries are ignored.
+type Observers []Observer
+
+// Implement `Observer`.
+func (self Observers) Observe(val Event) {
+	for _, obs := range self {
+		if obs != nil {
+			obs.Observe(val)
+		}
+	}
+}
+
+// Kind of an `Event`. Values are short lowercase words, suitable for logging.
+type EventKind string
+
+const (
+	// A task was created and is about to start.
+	EventCreated EventKind = "created"
+
+	// A task function began executing.
+	EventStarted EventKind = "started"
+
+	// A task began waiting on another task, named by `Event.Dep`.
+	EventWaiting EventKind = "waiting"
+
+	// A task function returned without an error.
+	EventFinished EventKind = "finished"
+
+	// A task function returned an error.
+	EventFailed EventKind = "failed"
+
+	// A task function panicked.
+	EventPanicked EventKind = "panicked"
+
+	// A task was completed without executing its function. Sent instead of
+	// `EventFinished`; `Event.Msg` says why.
+	EventSkipped EventKind = "skipped"
+
+	// In a dry run, a task would execute its function; see `Conf.DryRun`.
+	// Sent instead of `EventFinished`.
+	EventPlanned EventKind = "planned"
+
+	// A task function failed and is about to be retried; see `Retry`.
+	EventRetrying EventKind = "retrying"
+
+	// A task is blocked on a resource, named by `Event.Resource`; see `Acquire`.
+	EventBlocked EventKind = "blocked"
+
+	// A task failed, and another task, named by `Event.Dep`, runs instead; see
+	// `Fallback`.
+	EventFallback EventKind = "fallback"
+
+	// A task wrote a line of output, passed in `Event.Msg`; see `Output`.
+	EventOutput EventKind = "output"
+
+	// An error was logged via `Log` or `Opt`, without failing a task.
+	EventError EventKind = "error"
+)
+
+/*
+Describes something that happened to a task. Not every field is relevant to
+every kind of event.
+*/
+type Event struct {
+	Kind EventKind
+	Time time.Time
+
+	// Short name of the task, or the name passed to `Timing`.
+	Task string
+
+	// Identity of the task, unique within the process, which tells apart tasks
+	// with the same name, such as closures named "func1". Zero for events that
+	// don't come from a task, such as from `Timing`.
+	TaskID uint64
+
+	// Short name of the task being waited on, for `EventWaiting`.
+	Dep string
+
+	// Identity of the task being waited on, for `EventWaiting`; see `TaskID`.
+	DepID uint64
+
+	// Name of the resource being waited on, for `EventBlocked`.
+	Resource string
+
+	// Time spent running, for events that complete a task, or the delay before
+	// the next attempt, for `EventRetrying`.
+	Duration time.Duration
+
+	// Number of the attempt that failed, for `EventRetrying`.
+	Attempt int
+
+	// Error of a failed or panicked task, or the error passed to `Log`.
+	Err error
+
+	// Additional human-readable details, such as the reason for skipping, or
+	// a line of output without the trailing newline, for `EventOutput`.
+	Msg string
+}
+
+/*
+Default implementation of `Observer`, used by `DefaultObserver`. Writes
+human-readable lines:
+
+	[SomeTask] starting
+	[SomeTask] done in 1μs
+	[gtg] error: <some error>
+
+By default, logs everything except task creation and waiting.
+*/
+type Logger struct {
+	// Where to write. Nil means stderr.
+	Out io.Writer
+
+	// Also log task creation and waiting.
+	Verbose bool
+}
+
+// Implement `Observer`.
+func (self Logger) Observe(val Event) {
+	switch val.Kind {
+	case EventCreated:
+		if self.Verbose {
+			self.logf("[%v] created\n", val.Task)
+		}
+	case EventStarted:
+		self.logf("[%v] starting\n", val.Task)
+	case EventWaiting:
+		if self.Verbose {
+			self.logf("[%v] waiting on [%v]\n", val.Task, val.Dep)
+		}
+	case EventFinished:
+		self.logf("[%v] done in %v\n", val.Task, val.Duration)
+	case EventFailed, EventPanicked:
+		self.logf("[%v] %v in %v\n", val.Task, val.Kind, val.Duration)
+	case EventPlanned:
+		self.logf("[%v] %v\n", val.Task, val.Msg)
+	case EventSkipped:
+		if val.Msg != "" {
+			self.logf("[%v] skipped: %v\n", val.Task, val.Msg)
+		} else {
+			self.logf("[%v] skipped\n", val.Task)
+		}
+	case EventFallback:
+		self.logf("[%v] failed, falling back on [%v]: %v\n", val.Task, val.Dep, val.Err)
+	case EventRetrying:
+		self.logf("[%v] attempt %v failed, retrying in %v: %v\n", val.Task, val.Attempt, val.Duration, val.Err)
+	case EventBlocked:
+		self.logf("[%v] blocked on resource %q\n", val.Task, val.Resource)
+	case EventOutput:
+		self.logf("[%v] %v\n", val.Task, val.Msg)
+	case EventError:
+		self.logf("[gtg] error: %+v\n", val.Err)
+	}
+}
+
+func (self Logger) logf(pattern string, args ...interface{}) {
+	out := self.Out
+	if out == nil {
+		out = logOutput
+	}
+	_, _ = fmt.Fprintf(out, pattern, args...)
+}
+
+/*
+Adapter from `Observer` to structured logging via "log/slog". Creation and
+waiting are logged at debug level, retries and fallbacks at warning level,
+failures and errors at error level, and everything else at info level. The
+message is the event kind.
+*/
+type SlogObserver struct {
+	// Nil means `slog.Default()`.
+	Logger *slog.Logger
+}
+
+// Implement `Observer`.
+func (self SlogObserver) Observe(val Event) {
+	logger := self.Logger
+	if logger == nil {
+		logger = slog.Default()
+	}
+
+	ctx := context.Background()
+	level := slogLevel(val.Kind)
+	handler := logger.Handler()
+	if !handler.Enabled(ctx, level) {
+		return
+	}
+
+	rec := slog.NewRecord(val.Time, level, string(val.Kind), 0)
+	if val.Task != "" {
+		rec.AddAttrs(slog.String("task", val.Task))
+	}
+	if val.Dep != "" {
+		rec.AddAttrs(slog.String("dep", val.Dep))
+	}
+	if val.Resource != "" {
+		rec.AddAttrs(slog.String("resource", val.Resource))
+	}
+	if val.Duration != 0 {
+		rec.AddAttrs(slog.Duration("duration", val.Duration))
+	}
+	if val.Attempt != 0 {
+		rec.AddAttrs(slog.Int("attempt", val.Attempt))
+	}
+	if val.Err != nil {
+		rec.AddAttrs(slog.Any("err", val.Err))
+	}
+	if val.Msg != "" {
+		rec.AddAttrs(slog.String("details", val.Msg))
+	}
+	_ = handler.Handle(ctx, rec)
+}
+
+func slogLevel(kind EventKind) slog.Level {
+	switch kind {
+	case EventCreated, EventWaiting:
+		return slog.LevelDebug
+	case EventRetrying, EventFallback:
+		return slog.LevelWarn
+	case EventFailed, EventPanicked, EventError:
+		return slog.LevelError
+	default:
+		return slog.LevelInfo
+	}
+}
@@ -0,0 +1,129 @@
+package gtg
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestObserver(t *testing.T) {
+	t.Run("task events", func(t *testing.T) {
+		var events eventLog
+
+		err := Conf{Observer: &events}.Run(context.Background(), func(task Task) error {
+			return Wait(task, TaskFuncImmediateErr)
+		})
+		neq(nil, err)
+
+		eq(
+			[]EventKind{EventCreated, EventStarted, EventFailed},
+			events.kinds("TaskFuncImmediateErr"),
+		)
+
+		waits := events.filter(EventWaiting)
+		eq(1, len(waits))
+		eq("TaskFuncImmediateErr", waits[0].Dep)
+
+		failed := events.filter(EventFailed)
+		eq(2, len(failed))
+		for _, val := range failed {
+			eq(false, val.Time.IsZero())
+			neq(nil, val.Err)
+		}
+	})
+
+	t.Run("opt errors go to group observer", func(t *testing.T) {
+		var events eventLog
+
+		err := Conf{Observer: &events}.Run(context.Background(), Opt(TaskFuncImmediateErr))
+		eq(nil, err)
+		eq(1, len(events.filter(EventError)))
+	})
+
+	t.Run("default observer", func(t *testing.T) {
+		var events eventLog
+		defer swapDefaultObserver(&events)()
+
+		Log(errors.New(`logged`))
+		Timing("some_task")()
+
+		eq([]EventKind{EventError}, events.kinds(""))
+		eq([]EventKind{EventStarted, EventFinished}, events.kinds("some_task"))
+	})
+}
+
+func TestLogger(t *testing.T) {
+	var buf strings.Builder
+	obs := Logger{Out: &buf}
+
+	obs.Observe(Event{Kind: EventCreated, Task: "A"})
+	obs.Observe(Event{Kind: EventStarted, Task: "A"})
+	obs.Observe(Event{Kind: EventWaiting, Task: "A", Dep: "B"})
+	obs.Observe(Event{Kind: EventFailed, Task: "A", Err: errors.New(`fail`)})
+	obs.Observe(Event{Kind: EventError, Err: errors.New(`fail`)})
+
+	eq(`[A] starting
+[A] failed in 0s
+[gtg] error: fail
+`, buf.String())
+
+	buf.Reset()
+	obs.Verbose = true
+	obs.Observe(Event{Kind: EventWaiting, Task: "A", Dep: "B"})
+	eq("[A] waiting on [B]\n", buf.String())
+}
+
+func TestSlogObserver(t *testing.T) {
+	var buf strings.Builder
+	obs := SlogObserver{Logger: slog.New(slog.NewTextHandler(&buf, nil))}
+
+	obs.Observe(Event{Kind: EventWaiting, Task: "A", Dep: "B"})
+	eq("", buf.String())
+
+	obs.Observe(Event{Kind: EventFailed, Task: "A", Err: errors.New(`fail`)})
+	out := buf.String()
+	eq(true, strings.Contains(out, `level=ERROR msg=failed task=A err=fail`))
+}
+
+type eventLog struct {
+	lock   sync.Mutex
+	events []Event
+}
+
+func (self *eventLog) Observe(val Event) {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	self.events = append(self.events, val)
+}
+
+func (self *eventLog) filter(kind EventKind) (out []Event) {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	for _, val := range self.events {
+		if val.Kind == kind {
+			out = append(out, val)
+		}
+	}
+	return
+}
+
+// Kinds of events of the given task, excluding waits by that task.
+func (self *eventLog) kinds(task string) (out []EventKind) {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	for _, val := range self.events {
+		if val.Task == task && val.Kind != EventWaiting {
+			out = append(out, val.Kind)
+		}
+	}
+	return
+}
+
+func swapDefaultObserver(obs Observer) func() {
+	prev := DefaultObserver
+	DefaultObserver = obs
+	return func() { DefaultObserver = prev }
+}
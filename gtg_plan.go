@@ -0,0 +1,265 @@
+package gtg
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+/*
+Declares prerequisites of a task function, and returns the function. Before
+running the function, its task starts all of these dependencies together, and
+waits for them, failing if any of them fails. Unlike `Wait` calls inside the
+function, declared dependencies are known without running it, which allows to
+plan a run; see `Conf.DryRun`. Dependencies are declared globally, usually in
+an "init" function:
+
+	func init() {
+		Deps(Build, Generate, Install)
+		Deps(Deploy, Build)
+	}
+
+Declaring the dependencies of the same function again replaces them. A task
+whose declared dependencies have a cycle fails without running. Declared
+dependencies are listed by the "--help" flag of `RunCmd`, and can be exported
+via `WriteGraph`. Like `Fresh`, meant for functions defined once.
+*/
+func Deps(fun TaskFunc, deps ...TaskFunc) TaskFunc {
+	declareDeps(fun, deps)
+	return fun
+}
+
+// Returns the dependencies of a task function declared via `Deps`.
+func DepsOf(fun TaskFunc) []TaskFunc {
+	return append([]TaskFunc(nil), declaredDeps(fun)...)
+}
+
+/*
+Writes the graph of dependencies declared via `Deps`, starting with the given
+task functions, in the Graphviz DOT format. Doesn't run any tasks, and doesn't
+include dependencies expressed only by `Wait` calls inside task functions.
+Edges point from tasks to their dependencies. Returns an error if the
+dependencies have a cycle. Usage:
+
+	WriteGraph(os.Stdout, Deploy)
+
+CLI scripts can use the "--graph=<file>" flag of `RunCmd`.
+*/
+func WriteGraph(out io.Writer, funs ...TaskFunc) error {
+	list, err := walkDeps(funs)
+	if err != nil {
+		return err
+	}
+
+	var buf strings.Builder
+	buf.WriteString("digraph gtg {\n")
+	for _, fun := range list {
+		fmt.Fprintf(&buf, "\t%q;\n", fun.ShortName())
+	}
+	for _, fun := range list {
+		for _, dep := range declaredDeps(fun) {
+			fmt.Fprintf(&buf, "\t%q -> %q;\n", fun.ShortName(), dep.ShortName())
+		}
+	}
+	buf.WriteString("}\n")
+
+	_, err = io.WriteString(out, buf.String())
+	return err
+}
+
+/*
+Returns the given functions and their dependencies declared via `Deps`, each
+function after its dependencies. Returns an error if the dependencies have a
+cycle.
+*/
+func walkDeps(funs []TaskFunc) ([]TaskFunc, error) {
+	const (
+		visiting = 1
+		visited  = 2
+	)
+
+	var out []TaskFunc
+	var path []TaskFunc
+	state := map[uintptr]int{}
+
+	var walk func(TaskFunc) error
+	walk = func(fun TaskFunc) error {
+		switch state[fun.id()] {
+		case visited:
+			return nil
+		case visiting:
+			var names []string
+			for ind := len(path) - 1; ind >= 0 && !path[ind].equal(fun); ind-- {
+				names = append(names, path[ind].ShortName())
+			}
+			names = append(names, fun.ShortName())
+			for one, two := 0, len(names)-1; one < two; one, two = one+1, two-1 {
+				names[one], names[two] = names[two], names[one]
+			}
+			names = append(names, fun.ShortName())
+			return fmt.Errorf(`dependency cycle: %v`, strings.Join(names, " -> "))
+		}
+
+		state[fun.id()] = visiting
+		path = append(path, fun)
+		for _, dep := range declaredDeps(fun) {
+			err := walk(dep)
+			if err != nil {
+				return err
+			}
+		}
+		path = path[:len(path)-1]
+		state[fun.id()] = visited
+		out = append(out, fun)
+		return nil
+	}
+
+	for _, fun := range funs {
+		err := walk(fun)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
+
+/*
+Declares how to check whether a task function is up to date, and returns the
+function. Before running the function, its task calls the check, unless any of
+its prerequisites did some work; see `Deps`. If the check reports the task as
+up to date, the task is skipped, with the note "up to date". In a dry run, the
+note is "would skip: up to date"; see `Conf.DryRun`. Usage:
+
+	func init() {
+		Fresh(Generate, NewerThan("gen.go", "schema.sql"))
+	}
+
+Declaring the check of the same function again replaces it. Declarations, and
+the functions they're about, are kept for the lifetime of the process. They're
+meant for statically defined functions, or closures defined once; declaring
+them for closures created anew on every call grows memory without bound.
+*/
+func Fresh(fun TaskFunc, check func(Task) (bool, error)) TaskFunc {
+	declareFresh(fun, check)
+	return fun
+}
+
+/*
+Freshness check for `Fresh`, similar to Make: the task is up to date if the
+target file exists, and is at least as new as every source file. Missing
+sources are an error.
+*/
+func NewerThan(target string, sources ...string) func(Task) (bool, error) {
+	return func(Task) (bool, error) {
+		info, err := os.Stat(target)
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		if err != nil {
+			return false, err
+		}
+
+		for _, path := range sources {
+			src, err := os.Stat(path)
+			if err != nil {
+				return false, err
+			}
+			if src.ModTime().After(info.ModTime()) {
+				return false, nil
+			}
+		}
+		return true, nil
+	}
+}
+
+/*
+Result of `MakePlan`: tasks of a group in order of completion, which is an order
+in which they may run one by one.
+*/
+type Plan struct {
+	Steps []PlanStep
+}
+
+// One task in a `Plan`.
+type PlanStep struct {
+	Task   string
+	Status Status
+
+	// Short names of the tasks this task waited on.
+	Deps []string
+
+	// See `TaskInfo.Note`.
+	Note string
+}
+
+/*
+Returns the plan of a finished dry run; see `Conf.DryRun`. Also works for
+normal runs, describing what happened. Usage:
+
+	task := Conf{DryRun: true}.Start(ctx, Deploy)
+	<-task.Done()
+	fmt.Println(MakePlan(task))
+*/
+func MakePlan(group TaskGroup) Plan {
+	var out Plan
+	tg := groupOf(group)
+	if tg == nil {
+		return out
+	}
+
+	tasks := tg.all()
+	sort.SliceStable(tasks, func(one, two int) bool {
+		_, _, oneEnd := tasks[one].times()
+		_, _, twoEnd := tasks[two].times()
+		return oneEnd.Before(twoEnd)
+	})
+
+	for _, task := range tasks {
+		info := task.info()
+		out.Steps = append(out.Steps, PlanStep{
+			Task:   info.Task,
+			Status: info.Status,
+			Deps:   info.Deps,
+			Note:   info.Note,
+		})
+	}
+	return out
+}
+
+// Renders a numbered list; see `Plan.WriteTo`.
+func (self Plan) String() string {
+	var buf strings.Builder
+	_, _ = self.WriteTo(&buf)
+	return buf.String()
+}
+
+/*
+Writes a numbered list of steps, with their notes, or statuses for tasks without
+notes, and their dependencies.
+*/
+func (self Plan) WriteTo(out io.Writer) (int64, error) {
+	var count countWriter
+	count.out = out
+
+	_, _ = fmt.Fprintf(&count, "plan:\n")
+	tab := tabwriter.NewWriter(&count, 0, 0, 2, ' ', 0)
+
+	for ind, val := range self.Steps {
+		note := val.Note
+		if note == "" {
+			note = val.Status.String()
+		}
+
+		deps := ""
+		if len(val.Deps) > 0 {
+			deps = "after " + strings.Join(val.Deps, ", ")
+		}
+		_, _ = fmt.Fprintf(tab, "  %v.\t%v\t%v\t%v\n", ind+1, val.Task, note, deps)
+	}
+
+	err := tab.Flush()
+	return count.n, err
+}
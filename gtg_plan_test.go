@@ -0,0 +1,192 @@
+package gtg
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+var planRuns int32
+
+func TaskFuncPlanGen(Task) error     { atomic.AddInt32(&planRuns, 1); return nil }
+func TaskFuncPlanInstall(Task) error { atomic.AddInt32(&planRuns, 1); return nil }
+func TaskFuncPlanBuild(Task) error   { atomic.AddInt32(&planRuns, 1); return nil }
+func TaskFuncPlanDeploy(Task) error  { atomic.AddInt32(&planRuns, 1); return nil }
+
+func isFresh(Task) (bool, error) { return true, nil }
+func isStale(Task) (bool, error) { return false, nil }
+
+func init() {
+	Fresh(TaskFuncPlanGen, isFresh)
+	Fresh(TaskFuncPlanInstall, isStale)
+	Deps(TaskFuncPlanBuild, TaskFuncPlanGen, TaskFuncPlanInstall)
+	Fresh(TaskFuncPlanBuild, isFresh)
+	Deps(TaskFuncPlanDeploy, TaskFuncPlanBuild)
+}
+
+func TestDryRun(t *testing.T) {
+	atomic.StoreInt32(&planRuns, 0)
+
+	var events eventLog
+	task := Conf{DryRun: true, Observer: &events}.Start(context.Background(), TaskFuncPlanDeploy)
+	waitDone(task)
+	eq(nil, task.Err())
+	eq(int32(0), atomic.LoadInt32(&planRuns))
+
+	// Each task is completed by exactly one event.
+	eq([]EventKind{EventCreated, EventSkipped}, events.kinds("TaskFuncPlanGen"))
+	eq([]EventKind{EventCreated, EventPlanned}, events.kinds("TaskFuncPlanInstall"))
+
+	plan := MakePlan(task)
+	eq(4, len(plan.Steps))
+
+	notes := map[string]string{}
+	for _, val := range plan.Steps {
+		eq(StatusSkipped, val.Status)
+		notes[val.Task] = val.Note
+	}
+	eq(map[string]string{
+		"TaskFuncPlanGen":     "would skip: up to date",
+		"TaskFuncPlanInstall": "would run",
+		"TaskFuncPlanBuild":   "would run",
+		"TaskFuncPlanDeploy":  "would run",
+	}, notes)
+
+	last := plan.Steps[len(plan.Steps)-1]
+	eq("TaskFuncPlanDeploy", last.Task)
+	eq([]string{"TaskFuncPlanBuild"}, last.Deps)
+	eq("TaskFuncPlanBuild", plan.Steps[2].Task)
+
+	out := plan.String()
+	eq(true, strings.HasPrefix(out, "plan:\n  1."))
+	eq(true, strings.Contains(out, "4.  TaskFuncPlanDeploy   would run"))
+}
+
+func TestFresh(t *testing.T) {
+	atomic.StoreInt32(&planRuns, 0)
+
+	var events eventLog
+	task := Conf{Observer: &events}.Start(context.Background(), TaskFuncPlanDeploy)
+	waitDone(task)
+	eq(nil, task.Err())
+
+	var buf strings.Builder
+	for _, val := range events.events {
+		Logger{Out: &buf}.Observe(val)
+	}
+	out := buf.String()
+	eq(true, strings.Contains(out, "[TaskFuncPlanGen] skipped: up to date\n"))
+	eq(false, strings.Contains(out, "[TaskFuncPlanGen] done"))
+
+	// "Gen" is up to date. "Build" is declared up to date too, but one of its
+	// dependencies did some work, so it runs.
+	eq(int32(3), atomic.LoadInt32(&planRuns))
+
+	statuses := map[string]Status{}
+	for _, val := range Snapshot(task) {
+		statuses[val.Task] = val.Status
+	}
+	eq(StatusSkipped, statuses["TaskFuncPlanGen"])
+	eq(StatusDone, statuses["TaskFuncPlanInstall"])
+	eq(StatusDone, statuses["TaskFuncPlanBuild"])
+
+	// Starting "Deploy" checked the whole graph for cycles, once.
+	eq(4, len(groupOf(task).checked))
+
+	t.Run("dependency failure", func(t *testing.T) {
+		var ran bool
+		fun := Deps(func(Task) error {
+			ran = true
+			return nil
+		}, TaskFuncImmediateErr)
+
+		task := Start(context.Background(), fun)
+		waitDone(task)
+		neq(nil, task.Err())
+		eq(true, strings.Contains(task.Err().Error(), "prerequisite failed"))
+		eq(false, ran)
+	})
+}
+
+func TestNewerThan(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src")
+	target := filepath.Join(dir, "target")
+	check := NewerThan(target, src)
+
+	Must(os.WriteFile(src, nil, os.ModePerm))
+	fresh, err := check(nil)
+	eq(nil, err)
+	eq(false, fresh)
+
+	Must(os.WriteFile(target, nil, os.ModePerm))
+	past := time.Now().Add(-time.Hour)
+	Must(os.Chtimes(src, past, past))
+	fresh, err = check(nil)
+	eq(nil, err)
+	eq(true, fresh)
+
+	Must(os.Chtimes(target, past.Add(-time.Hour), past.Add(-time.Hour)))
+	fresh, err = check(nil)
+	eq(nil, err)
+	eq(false, fresh)
+
+	_, err = NewerThan(target, filepath.Join(dir, "missing"))(nil)
+	neq(nil, err)
+}
+
+func TestWriteGraph(t *testing.T) {
+	var buf strings.Builder
+	eq(nil, WriteGraph(&buf, TaskFuncPlanDeploy))
+	eq(`digraph gtg {
+	"TaskFuncPlanGen";
+	"TaskFuncPlanInstall";
+	"TaskFuncPlanBuild";
+	"TaskFuncPlanDeploy";
+	"TaskFuncPlanBuild" -> "TaskFuncPlanGen";
+	"TaskFuncPlanBuild" -> "TaskFuncPlanInstall";
+	"TaskFuncPlanDeploy" -> "TaskFuncPlanBuild";
+}
+`, buf.String())
+
+	eq(2, len(DepsOf(TaskFuncPlanBuild)))
+	eq(0, len(DepsOf(TaskFuncPlanGen)))
+}
+
+func TaskFuncCycleOne(Task) error   { return nil }
+func TaskFuncCycleTwo(Task) error   { return nil }
+func TaskFuncCycleThree(Task) error { return nil }
+
+func TestDepsCycle(t *testing.T) {
+	Deps(TaskFuncCycleOne, TaskFuncCycleTwo)
+	Deps(TaskFuncCycleTwo, TaskFuncCycleThree)
+	Deps(TaskFuncCycleThree, TaskFuncCycleTwo)
+	defer Deps(TaskFuncCycleThree)
+
+	const msg = `dependency cycle: TaskFuncCycleTwo -> TaskFuncCycleThree -> TaskFuncCycleTwo`
+
+	err := WriteGraph(io.Discard, TaskFuncCycleOne)
+	neq(nil, err)
+	eq(msg, err.Error())
+
+	task := Start(context.Background(), TaskFuncCycleOne)
+	waitDone(task)
+	neq(nil, task.Err())
+	eq(true, strings.Contains(task.Err().Error(), msg))
+}
+
+func TestWriteHelp(t *testing.T) {
+	var buf strings.Builder
+	eq(nil, writeHelp(&buf, []TaskFunc{TaskFuncPlanBuild, TaskFuncPlanDeploy, TaskFuncPlanGen}))
+	eq(true, strings.HasPrefix(buf.String(), `tasks (case-insensitive):
+  TaskFuncPlanBuild   after TaskFuncPlanGen, TaskFuncPlanInstall
+  TaskFuncPlanDeploy  after TaskFuncPlanBuild
+  TaskFuncPlanGen
+`))
+	eq(true, strings.Contains(buf.String(), "\nflags:\n  --summary "))
+}
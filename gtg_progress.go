@@ -0,0 +1,298 @@
+package gtg
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+/*
+Returns a writer for the output of the given task, such as its logs or the
+output of subprocesses. The last MiB or so of output is kept with the task, see
+`TaskInfo.Output`, and each line is reported to the group's observer as
+`EventOutput`, which allows observers such as `Progress` to group the output of
+concurrent tasks. If the group has no observer, output is also written to
+stderr as-is. Usage:
+
+	func Build(task Task) error {
+		out := Output(task)
+		fmt.Fprintln(out, "building")
+
+		cmd := exec.CommandContext(task, "go", "build")
+		cmd.Stdout = out
+		cmd.Stderr = out
+		return cmd.Run()
+	}
+
+For values other than tasks created by Gtg, returns stderr.
+*/
+func Output(val Task) io.Writer {
+	switch val := val.(type) {
+	case *task:
+		return taskOutput{val}
+	case taskInner:
+		return taskOutput{val.task}
+	}
+	return logOutput
+}
+
+type taskOutput struct{ task *task }
+
+// Implement `io.Writer`.
+func (self taskOutput) Write(val []byte) (int, error) {
+	if self.task.taskGroup.conf.Observer == nil {
+		_, _ = logOutput.Write(val)
+	}
+	self.task.write(val)
+	return len(val), nil
+}
+
+/*
+Observer that displays the progress of a group on a terminal. Shows a
+continuously updated list of running tasks with their elapsed time, and a
+summary line with the counts of finished tasks. Finished tasks are removed from
+the list; failed tasks and tasks with output, see `Output`, are printed above
+it, with the output grouped by task. When the output isn't a terminal, falls
+back to plain lines like `Logger`, still grouping the output of each task.
+
+Must be closed after running. CLI scripts can use the "--progress" flag of
+`RunCmd`. Usage:
+
+	progress := NewProgress(os.Stderr)
+	err := Conf{Observer: progress}.Run(ctx, SomeTask)
+	progress.Close()
+*/
+type Progress struct {
+	out     io.Writer
+	tty     bool
+	lock    sync.Mutex
+	start   time.Time
+	running []progressTask
+	output  map[progressKey][]string
+	counts  map[EventKind]int
+	height  int
+	frame   int
+	closed  bool
+	stop    chan struct{}
+	stopped chan struct{}
+}
+
+type progressTask struct {
+	key   progressKey
+	start time.Time
+}
+
+/*
+Identifies a task in `Progress`. Tasks with the same name, such as closures,
+are told apart by `Event.TaskID`.
+*/
+type progressKey struct {
+	id   uint64
+	name string
+}
+
+func eventKey(val Event) progressKey { return progressKey{val.TaskID, val.Task} }
+
+/*
+Creates a `Progress` writing to the given output; nil means stderr. Live
+display is used only when the output is a terminal.
+*/
+func NewProgress(out io.Writer) *Progress {
+	if out == nil {
+		out = logOutput
+	}
+	return newProgress(out, isTerminal(out))
+}
+
+func newProgress(out io.Writer, tty bool) *Progress {
+	self := &Progress{
+		out:    out,
+		tty:    tty,
+		start:  time.Now(),
+		output: map[progressKey][]string{},
+		counts: map[EventKind]int{},
+	}
+
+	if tty {
+		self.stop = make(chan struct{})
+		self.stopped = make(chan struct{})
+		go self.tick()
+	}
+	return self
+}
+
+const progressInterval = 100 * time.Millisecond
+
+var progressFrames = []string{"⠋", "⠙", "⠹", "⠸", "⠼", "⠴", "⠦", "⠧", "⠇", "⠏"}
+
+// Implement `Observer`.
+func (self *Progress) Observe(val Event) {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+
+	switch val.Kind {
+	case EventStarted:
+		self.running = append(self.running, progressTask{eventKey(val), val.Time})
+		if self.tty {
+			self.render("")
+		} else {
+			self.print(val)
+		}
+
+	case EventOutput:
+		key := eventKey(val)
+		self.output[key] = append(self.output[key], val.Msg)
+
+	case EventFinished, EventFailed, EventPanicked, EventSkipped, EventPlanned:
+		self.counts[val.Kind]++
+		key := eventKey(val)
+		self.remove(key)
+		lines := self.output[key]
+		delete(self.output, key)
+
+		if self.tty && val.Kind == EventFinished && len(lines) == 0 {
+			self.render("")
+			return
+		}
+
+		var buf bytes.Buffer
+		Logger{Out: &buf}.Observe(val)
+		for _, line := range lines {
+			fmt.Fprintf(&buf, "    %v\n", line)
+		}
+		self.write(buf.String())
+
+	default:
+		self.print(val)
+	}
+}
+
+/*
+Stops the live display, leaving a final summary line in its place. Further
+events are printed as plain lines. Always returns nil.
+*/
+func (self *Progress) Close() error {
+	self.lock.Lock()
+	if self.closed {
+		self.lock.Unlock()
+		return nil
+	}
+	self.closed = true
+	if self.tty {
+		self.render(fmt.Sprintf("[gtg] %v\n", self.status(time.Now())))
+	}
+	self.lock.Unlock()
+
+	if self.stop != nil {
+		close(self.stop)
+		<-self.stopped
+	}
+	return nil
+}
+
+func (self *Progress) tick() {
+	defer close(self.stopped)
+	ticker := time.NewTicker(progressInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-self.stop:
+			return
+		case <-ticker.C:
+			self.lock.Lock()
+			self.frame++
+			if !self.closed {
+				self.render("")
+			}
+			self.lock.Unlock()
+		}
+	}
+}
+
+// Prints the event as a plain line, in the format of `Logger`.
+func (self *Progress) print(val Event) {
+	var buf bytes.Buffer
+	Logger{Out: &buf}.Observe(val)
+	if buf.Len() > 0 {
+		self.write(buf.String())
+	}
+}
+
+// Writes lines that stay on the screen, above the live display, if any.
+func (self *Progress) write(text string) {
+	if self.tty && !self.closed {
+		self.render(text)
+	} else {
+		_, _ = io.WriteString(self.out, text)
+	}
+}
+
+/*
+Erases the live display, writes the given text, and draws the display again
+below it, unless closed. Must be called under lock.
+*/
+func (self *Progress) render(text string) {
+	var buf bytes.Buffer
+	if self.height > 0 {
+		fmt.Fprintf(&buf, "\x1b[%dA\x1b[J", self.height)
+	}
+	buf.WriteString(text)
+	self.height = 0
+
+	if !self.closed {
+		now := time.Now()
+		frame := progressFrames[self.frame%len(progressFrames)]
+		fmt.Fprintf(&buf, "[gtg] %v\n", self.status(now))
+		self.height++
+
+		for _, val := range self.running {
+			fmt.Fprintf(&buf, "  %v %v %v\n", frame, val.key.name, now.Sub(val.start).Round(time.Millisecond))
+			self.height++
+		}
+	}
+
+	_, _ = self.out.Write(buf.Bytes())
+}
+
+// Summary line, such as "3 done, 1 failed, 1 skipped, 2 running, 1.5s".
+func (self *Progress) status(now time.Time) string {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "%v done", self.counts[EventFinished])
+	if count := self.counts[EventFailed] + self.counts[EventPanicked]; count > 0 {
+		fmt.Fprintf(&buf, ", %v failed", count)
+	}
+	if count := self.counts[EventSkipped]; count > 0 {
+		fmt.Fprintf(&buf, ", %v skipped", count)
+	}
+	if count := self.counts[EventPlanned]; count > 0 {
+		fmt.Fprintf(&buf, ", %v planned", count)
+	}
+	if count := len(self.running); count > 0 {
+		fmt.Fprintf(&buf, ", %v running", count)
+	}
+	fmt.Fprintf(&buf, ", %v", now.Sub(self.start).Round(time.Millisecond))
+	return buf.String()
+}
+
+func (self *Progress) remove(key progressKey) {
+	for ind, val := range self.running {
+		if val.key == key {
+			self.running = append(self.running[:ind], self.running[ind+1:]...)
+			return
+		}
+	}
+}
+
+// True if the output is a terminal that supports cursor movement.
+func isTerminal(out io.Writer) bool {
+	file, ok := out.(*os.File)
+	if !ok || os.Getenv("TERM") == "dumb" {
+		return false
+	}
+	info, err := file.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
@@ -0,0 +1,153 @@
+package gtg
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TaskFuncOutput(task Task) error {
+	out := Output(task)
+	fmt.Fprint(out, "one\r\ntw")
+	fmt.Fprint(out, "o\nthree")
+	return nil
+}
+
+func TestOutput(t *testing.T) {
+	t.Run("with observer", func(t *testing.T) {
+		var events eventLog
+		task := Conf{Observer: &events}.Start(context.Background(), TaskFuncOutput)
+		waitDone(task)
+		eq(nil, task.Err())
+
+		var lines []string
+		for _, val := range events.filter(EventOutput) {
+			eq("TaskFuncOutput", val.Task)
+			lines = append(lines, val.Msg)
+		}
+		eq([]string{"one", "two", "three"}, lines)
+
+		info, _ := Inspect(task)
+		eq("one\r\ntwo\nthree", info.Output)
+
+		kinds := events.kinds("TaskFuncOutput")
+		eq(EventFinished, kinds[len(kinds)-1])
+	})
+
+	t.Run("without observer", func(t *testing.T) {
+		var buf bytes.Buffer
+		defer swapLogOutput(&buf)()
+
+		task := Start(context.Background(), TaskFuncOutput)
+		waitDone(task)
+		eq("one\r\ntwo\nthree", buf.String())
+	})
+
+	t.Run("limit", func(t *testing.T) {
+		var events eventLog
+		line := strings.Repeat("x", 1023) + "\n"
+		count := 3 * maxTaskOutput / len(line)
+
+		task := Conf{Observer: &events}.Start(context.Background(), func(task Task) error {
+			out := Output(task)
+			for range make([]struct{}, count) {
+				fmt.Fprint(out, line)
+			}
+			fmt.Fprint(out, "last")
+			return nil
+		})
+		waitDone(task)
+
+		eq(count+1, len(events.filter(EventOutput)))
+		info, _ := Inspect(task)
+		eq(true, len(info.Output) <= 2*maxTaskOutput)
+		eq(true, len(info.Output) >= maxTaskOutput)
+		eq(true, strings.HasPrefix(info.Output, line))
+		eq(true, strings.HasSuffix(info.Output, line+"last"))
+	})
+}
+
+func TaskFuncProgressMain(task Task) error {
+	fmt.Fprintln(Output(task), "main output")
+	_ = Wait(task, TaskFuncImmediateErr)
+	return Wait(task, TaskFuncSleep)
+}
+
+func TestProgress(t *testing.T) {
+	t.Run("plain", func(t *testing.T) {
+		var buf bytes.Buffer
+		progress := newProgress(&buf, false)
+		task := Conf{Observer: progress}.Start(context.Background(), TaskFuncProgressMain)
+		waitDone(task)
+		eq(nil, progress.Close())
+
+		out := buf.String()
+		eq(false, strings.Contains(out, "\x1b["))
+		eq(true, strings.Contains(out, "[TaskFuncSleep] starting\n"))
+		eq(true, strings.Contains(out, "[TaskFuncImmediateErr] failed in "))
+		eq(true, strings.Contains(out, "[TaskFuncProgressMain] done in "))
+
+		// Output is printed once the task finishes, right after its status line.
+		ind := strings.Index(out, "[TaskFuncProgressMain] done in ")
+		eq(true, strings.Contains(out[ind:], "\n    main output\n"))
+		eq(true, strings.Index(out, "main output") > strings.Index(out, "[TaskFuncSleep] done in "))
+	})
+
+	t.Run("tasks with the same name", func(t *testing.T) {
+		var buf bytes.Buffer
+		progress := newProgress(&buf, false)
+		progress.Observe(Event{Kind: EventStarted, Task: "func1", TaskID: 1})
+		progress.Observe(Event{Kind: EventStarted, Task: "func1", TaskID: 2})
+		progress.Observe(Event{Kind: EventOutput, Task: "func1", TaskID: 1, Msg: "one"})
+		progress.Observe(Event{Kind: EventOutput, Task: "func1", TaskID: 2, Msg: "two"})
+		progress.Observe(Event{Kind: EventFinished, Task: "func1", TaskID: 2})
+
+		eq(1, len(progress.running))
+		eq(uint64(1), progress.running[0].key.id)
+		out := buf.String()
+		eq(true, strings.HasSuffix(out, "[func1] done in 0s\n    two\n"))
+
+		progress.Observe(Event{Kind: EventFinished, Task: "func1", TaskID: 1})
+		eq(0, len(progress.running))
+		eq(true, strings.HasSuffix(buf.String(), "[func1] done in 0s\n    one\n"))
+		eq(nil, progress.Close())
+	})
+
+	t.Run("skipped", func(t *testing.T) {
+		var buf bytes.Buffer
+		progress := newProgress(&buf, false)
+		progress.Observe(Event{Kind: EventStarted, Task: "Gen", TaskID: 1})
+		progress.Observe(Event{Kind: EventSkipped, Task: "Gen", TaskID: 1, Msg: "up to date"})
+
+		eq(0, len(progress.running))
+		eq("[Gen] starting\n[Gen] skipped: up to date\n", buf.String())
+		eq(true, strings.HasPrefix(progress.status(time.Now()), "0 done, 1 skipped, "))
+		eq(nil, progress.Close())
+	})
+
+	t.Run("terminal", func(t *testing.T) {
+		var buf bytes.Buffer
+		progress := newProgress(&buf, true)
+		task := Conf{Observer: progress}.Start(context.Background(), func(task Task) error {
+			time.Sleep(progressInterval * 2)
+			return Wait(task, TaskFuncProgressMain)
+		})
+		waitDone(task)
+		eq(nil, progress.Close())
+		eq(nil, progress.Close())
+
+		out := buf.String()
+		eq(true, strings.Contains(out, "\x1b[J"))
+		eq(true, strings.Contains(out, " TaskFuncSleep "))
+		eq(true, strings.Contains(out, "[TaskFuncImmediateErr] failed in "))
+		eq(true, strings.Contains(out, "\n    main output\n"))
+		eq(false, strings.Contains(out, "[TaskFuncSleep] done in"))
+		eq(true, strings.Contains(out, "[gtg] 3 done, 1 failed, "))
+
+		// After closing, the summary line is the last thing on the screen.
+		eq(true, strings.HasPrefix(out[strings.LastIndex(out, "\x1b[J")+3:], "[gtg] 3 done, 1 failed, "))
+	})
+}
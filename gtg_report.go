@@ -0,0 +1,341 @@
+package gtg
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+/*
+Timing of every task in a group, as returned by `Summarize`. Tasks are sorted by
+self time (running minus waiting), descending, so the tasks that dominated the
+wall-clock time come first.
+*/
+type Summary struct {
+	// From the creation of the first task to the end of the last task, or to
+	// the moment of summarizing, if some tasks are still running.
+	Wall  time.Duration
+	Tasks []TaskSummary
+}
+
+// Timing and outcome of one task. See `Summary`.
+type TaskSummary struct {
+	Task   string
+	Status Status
+
+	// Between creation and start.
+	Queued time.Duration
+
+	// Between start and end, including time spent waiting on other tasks.
+	Running time.Duration
+
+	// Spent in `Wait`, `Par` and similar functions, waiting on other tasks.
+	// Approximate when a task waits on several goroutines at once.
+	Waiting time.Duration
+
+	Err error
+}
+
+// Running time minus waiting time.
+func (self TaskSummary) Self() time.Duration {
+	return self.Running - self.Waiting
+}
+
+/*
+Returns the timing of every task in the group of the given task. Gtg measures
+every task automatically; there's no need for `TaskTiming`. Usage:
+
+	task := Start(ctx, SomeTask)
+	<-task.Done()
+	fmt.Println(Summarize(task))
+
+For a `Summary` printed at the end of `Run` or `RunCmd`, use `Conf.Summary`.
+*/
+func Summarize(group TaskGroup) Summary {
+	var out Summary
+	tg := groupOf(group)
+	if tg == nil {
+		return out
+	}
+
+	var first, last time.Time
+	for _, task := range tg.all() {
+		sum := task.summary()
+		out.Tasks = append(out.Tasks, sum)
+
+		created, _, end := task.times()
+		if first.IsZero() || created.Before(first) {
+			first = created
+		}
+		if end.After(last) {
+			last = end
+		}
+	}
+	if !first.IsZero() {
+		out.Wall = last.Sub(first)
+	}
+
+	sort.SliceStable(out.Tasks, func(one, two int) bool {
+		return out.Tasks[one].Self() > out.Tasks[two].Self()
+	})
+	return out
+}
+
+// Renders a table; see `Summary.WriteTo`.
+func (self Summary) String() string {
+	var buf strings.Builder
+	_, _ = self.WriteTo(&buf)
+	return buf.String()
+}
+
+/*
+Writes a table with one row per task. The "share" column is the task's self time
+relative to the wall-clock time of the group.
+*/
+func (self Summary) WriteTo(out io.Writer) (int64, error) {
+	var count countWriter
+	count.out = out
+
+	tab := tabwriter.NewWriter(&count, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintf(tab, "task\tstatus\tqueued\trunning\twaiting\tself\tshare\n")
+
+	for _, val := range self.Tasks {
+		_, _ = fmt.Fprintf(
+			tab,
+			"%v\t%v\t%v\t%v\t%v\t%v\t%v\n",
+			val.Task, val.Status,
+			roundDur(val.Queued), roundDur(val.Running), roundDur(val.Waiting), roundDur(val.Self()),
+			share(val.Self(), self.Wall),
+		)
+	}
+
+	_, _ = fmt.Fprintf(tab, "total\t\t\t%v\t\t\t\n", roundDur(self.Wall))
+	err := tab.Flush()
+	return count.n, err
+}
+
+func roundDur(val time.Duration) time.Duration {
+	return val.Round(time.Microsecond)
+}
+
+func share(part, whole time.Duration) string {
+	if whole <= 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%.0f%%", float64(part)*100/float64(whole))
+}
+
+type countWriter struct {
+	out io.Writer
+	n   int64
+}
+
+func (self *countWriter) Write(src []byte) (int, error) {
+	n, err := self.out.Write(src)
+	self.n += int64(n)
+	return n, err
+}
+
+/*
+Result of `CriticalPath`: the chain of waits that determined the duration of a
+run, and the slack of every other task.
+*/
+type Path struct {
+	// Sum of self times of the tasks in `Critical`.
+	Duration time.Duration
+
+	// Tasks on the critical path, from the first to run to the last to finish.
+	// Each task waited on the previous one. Their slack is zero.
+	Critical []PathTask
+
+	// Tasks not on the critical path, sorted by slack, ascending.
+	Other []PathTask
+}
+
+// One task in a `Path`.
+type PathTask struct {
+	Task string
+
+	// Running time minus waiting time; see `TaskSummary.Self`.
+	Self time.Duration
+
+	// How much longer the task could have taken without making the critical
+	// path longer.
+	Slack time.Duration
+}
+
+/*
+Computes the critical path of a run, using the waits recorded between the tasks
+of the given group and their self times (running minus waiting). Should be used
+after the run is finished; tasks that haven't started are ignored. Usage:
+
+	task := Start(ctx, SomeTask)
+	<-task.Done()
+	fmt.Println(CriticalPath(task))
+
+This treats the recorded waits as a static graph, and uses the classic critical
+path method: a task starts as soon as everything it waited on is finished, and
+takes exactly its self time.
+*/
+func CriticalPath(group TaskGroup) Path {
+	var out Path
+	tg := groupOf(group)
+	if tg == nil {
+		return out
+	}
+
+	var nodes []*pathNode
+	index := map[*task]*pathNode{}
+	for _, task := range tg.all() {
+		sum := task.summary()
+		if sum.Status == StatusPending {
+			continue
+		}
+		node := &pathNode{task: task, self: maxDur(sum.Self(), 0)}
+		nodes = append(nodes, node)
+		index[task] = node
+	}
+
+	for _, node := range nodes {
+		for _, dep := range node.task.depList() {
+			depNode := index[dep]
+			if depNode != nil {
+				node.deps = append(node.deps, depNode)
+			}
+		}
+	}
+
+	// Forward pass. The resulting order has dependencies before dependents.
+	var order []*pathNode
+	for _, node := range nodes {
+		node.visit(&order)
+	}
+
+	var end *pathNode
+	for _, node := range nodes {
+		if end == nil || node.ef > end.ef {
+			end = node
+		}
+	}
+	if end == nil {
+		return out
+	}
+
+	// Backward pass.
+	for _, node := range nodes {
+		node.lf = end.ef
+	}
+	for ind := len(order) - 1; ind >= 0; ind-- {
+		node := order[ind]
+		for _, dep := range node.deps {
+			dep.lf = minDur(dep.lf, node.lf-node.self)
+		}
+	}
+
+	critical := map[*pathNode]bool{}
+	for node := end; node != nil && !critical[node]; node = node.criticalDep() {
+		critical[node] = true
+		out.Critical = append([]PathTask{node.pathTask()}, out.Critical...)
+		out.Duration += node.self
+	}
+
+	for _, node := range nodes {
+		if !critical[node] {
+			out.Other = append(out.Other, node.pathTask())
+		}
+	}
+	sort.SliceStable(out.Other, func(one, two int) bool {
+		return out.Other[one].Slack < out.Other[two].Slack
+	})
+	return out
+}
+
+// Renders a report; see `Path.WriteTo`.
+func (self Path) String() string {
+	var buf strings.Builder
+	_, _ = self.WriteTo(&buf)
+	return buf.String()
+}
+
+// Writes the critical path and the slack of other tasks as indented lists.
+func (self Path) WriteTo(out io.Writer) (int64, error) {
+	var count countWriter
+	count.out = out
+
+	tab := tabwriter.NewWriter(&count, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintf(tab, "critical path (%v):\n", roundDur(self.Duration))
+	for _, val := range self.Critical {
+		_, _ = fmt.Fprintf(tab, "  %v\t%v\n", val.Task, roundDur(val.Self))
+	}
+
+	if len(self.Other) > 0 {
+		_, _ = fmt.Fprintf(tab, "slack:\n")
+		for _, val := range self.Other {
+			_, _ = fmt.Fprintf(tab, "  %v\t%v\n", val.Task, roundDur(val.Slack))
+		}
+	}
+
+	err := tab.Flush()
+	return count.n, err
+}
+
+type pathNode struct {
+	task  *task
+	deps  []*pathNode
+	self  time.Duration
+	es    time.Duration // earliest start
+	ef    time.Duration // earliest finish
+	lf    time.Duration // latest finish
+	state byte
+}
+
+// Depth-first, ignoring cycles, which can't occur in a run that finished.
+func (self *pathNode) visit(order *[]*pathNode) {
+	if self.state != 0 {
+		return
+	}
+	self.state = 1
+
+	for _, dep := range self.deps {
+		dep.visit(order)
+		self.es = maxDur(self.es, dep.ef)
+	}
+
+	self.ef = self.es + self.self
+	self.state = 2
+	*order = append(*order, self)
+}
+
+// The dependency that finished last, delaying this task's start; nil if none.
+func (self *pathNode) criticalDep() *pathNode {
+	if self.es == 0 {
+		return nil
+	}
+	for _, dep := range self.deps {
+		if dep.ef == self.es {
+			return dep
+		}
+	}
+	return nil
+}
+
+func (self *pathNode) pathTask() PathTask {
+	return PathTask{Task: self.task.name(), Self: self.self, Slack: self.lf - self.ef}
+}
+
+func maxDur(one, two time.Duration) time.Duration {
+	if one > two {
+		return one
+	}
+	return two
+}
+
+func minDur(one, two time.Duration) time.Duration {
+	if one < two {
+		return one
+	}
+	return two
+}
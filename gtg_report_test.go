@@ -0,0 +1,128 @@
+package gtg
+
+import (
+	"context"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSummarize(t *testing.T) {
+	var buf strings.Builder
+
+	err := Conf{Summary: &buf}.Run(context.Background(), func(task Task) error {
+		return Wait(task, TaskFuncSleep)
+	})
+	eq(nil, err)
+
+	out := buf.String()
+	eq(true, strings.HasPrefix(out, "task "))
+	eq(true, strings.Contains(out, "TaskFuncSleep"))
+	eq(true, strings.Contains(out, "total"))
+
+	task := Start(context.Background(), func(task Task) error {
+		return Par(TaskFuncSleep, TaskFuncImmediateErr)(task)
+	})
+	waitDone(task)
+	waitDone(task.Task(TaskFuncSleep))
+
+	sum := Summarize(task)
+	eq(3, len(sum.Tasks))
+	eq("TaskFuncSleep", sum.Tasks[0].Task)
+	eq(StatusDone, sum.Tasks[0].Status)
+	eq(true, sum.Tasks[0].Self() >= 10*time.Millisecond)
+	eq(true, sum.Wall >= sum.Tasks[0].Running)
+
+	for _, val := range sum.Tasks[1:] {
+		if val.Task == "TaskFuncImmediateErr" {
+			eq(StatusFailed, val.Status)
+			neq(nil, val.Err)
+		} else {
+			eq(StatusFailed, val.Status)
+			eq(true, val.Waiting > 0)
+		}
+	}
+}
+
+// The list of flags in the documentation of `RunCmd` must match `cmdFlagDocs`.
+func TestCmdFlagsDoc(t *testing.T) {
+	src, err := os.ReadFile("gtg.go")
+	Must(err)
+
+	const head = "Supported flags:\n\n"
+	doc := string(src)
+	doc = doc[strings.Index(doc, head)+len(head):]
+	doc = doc[:strings.Index(doc, "\n\n")]
+
+	var lines []string
+	for _, line := range cmdFlagLines(true) {
+		lines = append(lines, "\t"+line)
+	}
+	eq(strings.Join(lines, "\n"), doc)
+}
+
+func TestParseCmdArgs(t *testing.T) {
+	flags, names, err := parseCmdArgs([]string{"one", "--summary", "two", "--trace=out.json", "--progress", "--dry-run", "--graph=out.dot", "-h", "--resume", "--report=junit:out.xml", "--report=tap"})
+	eq(nil, err)
+	eq([]string{"one", "two"}, names)
+	eq(cmdFlags{summary: true, trace: "out.json", progress: true, dryRun: true, resume: true, graph: "out.dot", help: true, reports: []string{"junit:out.xml", "tap"}}, flags)
+
+	_, _, err = parseCmdArgs([]string{"--unknown"})
+	neq(nil, err)
+
+	_, _, err = parseCmdArgs([]string{"--report=html:out.html"})
+	neq(nil, err)
+
+	flags, _, err = parseCmdArgs([]string{"--json"})
+	eq(nil, err)
+	eq("-", flags.json)
+
+	flags, _, err = parseCmdArgs([]string{"--json=events.ndjson"})
+	eq(nil, err)
+	eq("events.ndjson", flags.json)
+}
+
+func TaskFuncSleep(Task) error {
+	time.Sleep(10 * time.Millisecond)
+	return nil
+}
+
+func TestCriticalPath(t *testing.T) {
+	task := Start(context.Background(), TaskFuncPathMain)
+	waitDone(task)
+	eq(nil, task.Err())
+
+	path := CriticalPath(task)
+
+	var names []string
+	for _, val := range path.Critical {
+		names = append(names, val.Task)
+		eq(time.Duration(0), val.Slack)
+	}
+	eq([]string{"TaskFuncPathSlow", "TaskFuncPathMain"}, names)
+	eq(true, path.Duration >= 30*time.Millisecond)
+
+	eq(1, len(path.Other))
+	eq("TaskFuncPathFast", path.Other[0].Task)
+	eq(true, path.Other[0].Slack > 0)
+	eq(true, path.Other[0].Slack < path.Duration)
+
+	out := path.String()
+	eq(true, strings.HasPrefix(out, "critical path ("))
+	eq(true, strings.Contains(out, "slack:\n  TaskFuncPathFast"))
+}
+
+func TaskFuncPathMain(task Task) error {
+	return Par(TaskFuncPathSlow, TaskFuncPathFast)(task)
+}
+
+func TaskFuncPathSlow(Task) error {
+	time.Sleep(30 * time.Millisecond)
+	return nil
+}
+
+func TaskFuncPathFast(Task) error {
+	time.Sleep(5 * time.Millisecond)
+	return nil
+}
@@ -0,0 +1,147 @@
+package gtg
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+/*
+Acquires named resources on behalf of a task, blocking until all of them are
+available or the task's context is canceled. Returns a function that releases
+them, which should be deferred. Usage:
+
+	func TestDb(task Task) error {
+		release, err := Acquire(task, "postgres")
+		if err != nil {
+			return err
+		}
+		defer release()
+
+		// Use the database.
+		return nil
+	}
+
+Resources are semaphores shared by all tasks in the group. Their capacities are
+declared via `Conf.Resources`; undeclared resources are exclusive, with a
+capacity of 1. Names are acquired in sorted order, which prevents deadlocks
+between tasks acquiring several resources in one call. To avoid deadlocks, a
+task shouldn't acquire more resources while holding some, and shouldn't wait on
+tasks that may need the resources it holds.
+
+Time spent blocked counts as waiting, and is reported to the group's observer as
+`EventBlocked`.
+*/
+func Acquire(task Task, names ...string) (func(), error) {
+	tg := groupOf(task)
+	if tg == nil {
+		return nop, fmt.Errorf(`can't acquire resources in unknown task group %T`, task)
+	}
+
+	names = sortedUniq(names)
+	var held []chan struct{}
+	release := func() {
+		for ind := len(held) - 1; ind >= 0; ind-- {
+			<-held[ind]
+		}
+		held = nil
+	}
+
+	for _, name := range names {
+		sem := tg.resources.get(name)
+
+		select {
+		case sem <- struct{}{}:
+			held = append(held, sem)
+			continue
+		default:
+		}
+
+		done := blocked(task, name)
+		select {
+		case sem <- struct{}{}:
+			done()
+			held = append(held, sem)
+		case <-task.Done():
+			done()
+			release()
+			return nop, fmt.Errorf(`failed to acquire resource %q: %w`, name, task.Err())
+		}
+	}
+
+	var once sync.Once
+	return func() { once.Do(release) }, nil
+}
+
+// Shortcut for `Must(Acquire())`.
+func MustAcquire(task Task, names ...string) func() {
+	release, err := Acquire(task, names...)
+	Must(err)
+	return release
+}
+
+/*
+Semaphores shared by a group. Separate from `taskGroup` so that the same set
+can be shared by related groups.
+*/
+type resourceSet struct {
+	lock sync.Mutex
+	caps map[string]int
+	sems map[string]chan struct{}
+}
+
+func newResourceSet(caps map[string]int) *resourceSet {
+	return &resourceSet{caps: caps}
+}
+
+func (self *resourceSet) get(name string) chan struct{} {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+
+	sem := self.sems[name]
+	if sem != nil {
+		return sem
+	}
+
+	size := self.caps[name]
+	if size < 1 {
+		size = 1
+	}
+	sem = make(chan struct{}, size)
+
+	if self.sems == nil {
+		self.sems = map[string]chan struct{}{}
+	}
+	self.sems[name] = sem
+	return sem
+}
+
+/*
+If the task is the "inside" view of a task, notifies observers that it's blocked
+on the given resource. Returns a function that records the time spent blocked.
+*/
+func blocked(task Task, name string) func() {
+	inner, ok := task.(taskInner)
+	if !ok {
+		return nop
+	}
+
+	inner.task.emit(Event{Kind: EventBlocked, Task: inner.task.name(), Resource: name})
+	start := time.Now()
+	return func() { inner.task.addWaited(time.Since(start)) }
+}
+
+func sortedUniq(vals []string) []string {
+	out := append([]string(nil), vals...)
+	sort.Strings(out)
+
+	for ind := 1; ind < len(out); {
+		if out[ind] == out[ind-1] {
+			out = append(out[:ind], out[ind+1:]...)
+		} else {
+			ind++
+		}
+	}
+	return out
+}
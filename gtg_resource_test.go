@@ -0,0 +1,87 @@
+package gtg
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestAcquire(t *testing.T) {
+	t.Run("exclusive by default", func(t *testing.T) {
+		var events eventLog
+		var counter concurrency
+		fun0, fun1 := counter.acquiring("db"), counter.acquiring("db")
+
+		eq(nil, Conf{Observer: &events}.Run(context.Background(), Par(fun0, fun1)))
+		eq(int32(1), counter.max)
+
+		blocked := events.filter(EventBlocked)
+		eq(1, len(blocked))
+		eq("db", blocked[0].Resource)
+	})
+
+	t.Run("capacity", func(t *testing.T) {
+		var counter concurrency
+		fun0, fun1, fun2 := counter.acquiring("db"), counter.acquiring("db"), counter.acquiring("db")
+
+		conf := Conf{Resources: map[string]int{"db": 2}}
+		eq(nil, conf.Run(context.Background(), Par(fun0, fun1, fun2)))
+		eq(int32(2), counter.max)
+	})
+
+	t.Run("cancellation", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+
+		err := Run(ctx, func(task Task) error {
+			defer MustAcquire(task, "db")()
+
+			return Wait(task, func(task Task) error {
+				go cancel()
+				_, err := Acquire(task, "db", "another")
+				return err
+			})
+		})
+		eq(true, errors.Is(err, context.Canceled))
+	})
+
+	t.Run("release", func(t *testing.T) {
+		inside(func(task Task) {
+			release := MustAcquire(task, "one", "two", "one")
+			release()
+			release()
+			MustAcquire(task, "two", "one")()
+		})
+	})
+}
+
+func TestSortedUniq(t *testing.T) {
+	eq([]string(nil), sortedUniq(nil))
+	eq([]string{"one", "three", "two"}, sortedUniq([]string{"two", "one", "two", "three", "one"}))
+}
+
+// Tracks the maximum number of concurrent holders of a resource.
+type concurrency struct {
+	cur int32
+	max int32
+}
+
+func (self *concurrency) acquiring(name string) TaskFunc {
+	return func(task Task) error {
+		defer MustAcquire(task, name)()
+
+		cur := atomic.AddInt32(&self.cur, 1)
+		defer atomic.AddInt32(&self.cur, -1)
+
+		for {
+			max := atomic.LoadInt32(&self.max)
+			if cur <= max || atomic.CompareAndSwapInt32(&self.max, max, cur) {
+				break
+			}
+		}
+
+		time.Sleep(10 * time.Millisecond)
+		return nil
+	}
+}
@@ -0,0 +1,126 @@
+package gtg
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"sync"
+)
+
+// Used when `Conf.StateFile` is empty. Relative to the working directory.
+const DefaultStateFile = `.gtg-state.json`
+
+/*
+Declares how to hash the inputs of a task function, and returns the function.
+Used when resuming a run; see `Conf.Resume`. A task that succeeded in the
+previous run is skipped only if the hash of its inputs hasn't changed since
+then. Usage:
+
+	func init() {
+		Inputs(Generate, hashFiles("schema.sql"))
+	}
+
+Declaring the hash of the same function again replaces it. Like `Fresh`, meant
+for functions defined once.
+*/
+func Inputs(fun TaskFunc, hash func(Task) (string, error)) TaskFunc {
+	declareInputs(fun, hash)
+	return fun
+}
+
+// Format of `Conf.StateFile`. The version changes when the format does.
+type runState struct {
+	Version int                  `json:"version"`
+	Tasks   map[string]taskState `json:"tasks"`
+}
+
+type taskState struct {
+	Hash string `json:"hash,omitempty"`
+}
+
+const stateVersion = 2
+
+/*
+Tracks tasks that succeeded, in the previous run and in this one. See
+`Conf.Resume`.
+*/
+type stateSet struct {
+	lock sync.Mutex
+	path string
+	prev map[string]taskState
+	next map[string]taskState
+}
+
+/*
+Loads the state of the previous run. A missing file, or a file in another
+format version, is treated as an empty state.
+*/
+func loadState(path string) (*stateSet, error) {
+	out := &stateSet{
+		path: path,
+		prev: map[string]taskState{},
+		next: map[string]taskState{},
+	}
+
+	body, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return out, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var state runState
+	err = json.Unmarshal(body, &state)
+	if err != nil {
+		return nil, err
+	}
+
+	if state.Version == stateVersion {
+		for key, val := range state.Tasks {
+			out.prev[key] = val
+			out.next[key] = val
+		}
+	}
+	return out, nil
+}
+
+// True if the task succeeded in the previous run with the same input hash.
+func (self *stateSet) succeeded(name, hash string) bool {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	val, ok := self.prev[name]
+	return ok && val.Hash == hash
+}
+
+func (self *stateSet) record(name, hash string, ok bool) {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	if ok {
+		self.next[name] = taskState{Hash: hash}
+	} else {
+		delete(self.next, name)
+	}
+}
+
+/*
+Writes the state for resuming. After a complete successful run, there's nothing
+to resume, and the file is removed instead.
+*/
+func (self *stateSet) save(complete bool) error {
+	if complete {
+		err := os.Remove(self.path)
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+
+	self.lock.Lock()
+	body, err := json.MarshalIndent(runState{Version: stateVersion, Tasks: self.next}, "", "  ")
+	self.lock.Unlock()
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(self.path, append(body, '\n'), 0o644)
+}
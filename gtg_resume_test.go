@@ -0,0 +1,128 @@
+package gtg
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+var (
+	resumeRuns    = map[string]*int32{}
+	resumeFail    int32
+	resumeInput   atomic.Value
+	resumeFailing int32
+)
+
+func TaskFuncResumeOne(Task) error {
+	atomic.AddInt32(resumeRuns["one"], 1)
+	return nil
+}
+
+func TaskFuncResumeTwo(Task) error {
+	atomic.AddInt32(resumeRuns["two"], 1)
+	return nil
+}
+
+func TaskFuncResumeMain(Task) error {
+	atomic.AddInt32(resumeRuns["main"], 1)
+	if atomic.LoadInt32(&resumeFail) != 0 {
+		return errors.New(`last step failed`)
+	}
+	return nil
+}
+
+func TaskFuncResumeFailing(Task) error {
+	atomic.AddInt32(&resumeFailing, 1)
+	return errors.New(`always fails`)
+}
+
+// The wrappers share the name "func1"; the later successes must not mark the
+// earlier failure as succeeded.
+func TaskFuncResumeClosures(task Task) error {
+	err := Wait(task, Ser(TaskFuncResumeFailing))
+	MustWait(task, Ser(TaskFuncNop0))
+	MustWait(task, Opt(TaskFuncNop0))
+	return err
+}
+
+func init() {
+	resumeRuns["one"] = new(int32)
+	resumeRuns["two"] = new(int32)
+	resumeRuns["main"] = new(int32)
+	resumeInput.Store("v1")
+
+	Deps(TaskFuncResumeMain, TaskFuncResumeOne, TaskFuncResumeTwo)
+	Inputs(TaskFuncResumeTwo, func(Task) (string, error) {
+		return resumeInput.Load().(string), nil
+	})
+}
+
+func TestResume(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	conf := Conf{Resume: true, StateFile: path}
+	counts := func() []int32 {
+		var out []int32
+		for _, name := range []string{"one", "two", "main"} {
+			out = append(out, atomic.SwapInt32(resumeRuns[name], 0))
+		}
+		return out
+	}
+	counts()
+
+	atomic.StoreInt32(&resumeFail, 1)
+	neq(nil, conf.Run(context.Background(), TaskFuncResumeMain))
+	eq([]int32{1, 1, 1}, counts())
+
+	body, err := os.ReadFile(path)
+	eq(nil, err)
+	eq(true, strings.Contains(string(body), `"github.com/mitranim/gtg.TaskFuncResumeOne": {}`))
+	eq(true, strings.Contains(string(body), `"hash": "v1"`))
+	eq(false, strings.Contains(string(body), `TaskFuncResumeMain`))
+
+	// Only the failed task runs again.
+	neq(nil, conf.Run(context.Background(), TaskFuncResumeMain))
+	eq([]int32{0, 0, 1}, counts())
+
+	// Starting a group directly doesn't use or update the state.
+	main := conf.Start(context.Background(), TaskFuncResumeMain)
+	waitDone(main)
+	eq([]int32{1, 1, 1}, counts())
+	_, err = os.Stat(path)
+	eq(nil, err)
+
+	// Changed inputs invalidate the previous success.
+	resumeInput.Store("v2")
+	defer resumeInput.Store("v1")
+
+	atomic.StoreInt32(&resumeFail, 0)
+	eq(nil, conf.Run(context.Background(), TaskFuncResumeMain))
+	eq([]int32{0, 1, 1}, counts())
+
+	// After a successful run, there's nothing to resume.
+	_, err = os.Stat(path)
+	eq(true, errors.Is(err, os.ErrNotExist))
+
+	eq(nil, conf.Run(context.Background(), TaskFuncResumeMain))
+	eq([]int32{1, 1, 1}, counts())
+}
+
+func TestResumeClosures(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	conf := Conf{Resume: true, StateFile: path}
+	atomic.StoreInt32(&resumeFailing, 0)
+
+	neq(nil, conf.Run(context.Background(), TaskFuncResumeClosures))
+	eq(int32(1), atomic.LoadInt32(&resumeFailing))
+
+	body, err := os.ReadFile(path)
+	eq(nil, err)
+	eq(true, strings.Contains(string(body), `"github.com/mitranim/gtg.TaskFuncNop0": {}`))
+	eq(false, strings.Contains(string(body), `func1`))
+
+	neq(nil, conf.Run(context.Background(), TaskFuncResumeClosures))
+	eq(int32(2), atomic.LoadInt32(&resumeFailing))
+}
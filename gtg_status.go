@@ -0,0 +1,127 @@
+package gtg
+
+import (
+	"time"
+)
+
+// Lifecycle stage of a task. See `Inspect` and `Snapshot`.
+type Status byte
+
+const (
+	// Created, but not started, for example because it's waiting on
+	// prerequisites declared via `Order`.
+	StatusPending Status = iota
+
+	// The task function is executing.
+	StatusRunning
+
+	// The task function returned without an error.
+	StatusDone
+
+	// The task function returned an error.
+	StatusFailed
+
+	// The task function panicked.
+	StatusPanicked
+
+	// The task finished without doing its work, for example because the
+	// condition of `If` or `Unless` wasn't met, because it was up to date, or
+	// because of a dry run. See `TaskInfo.Note`.
+	StatusSkipped
+)
+
+// Implement `fmt.Stringer`. Values are short lowercase words.
+func (self Status) String() string {
+	switch self {
+	case StatusPending:
+		return "pending"
+	case StatusRunning:
+		return "running"
+	case StatusDone:
+		return "done"
+	case StatusFailed:
+		return "failed"
+	case StatusPanicked:
+		return "panicked"
+	case StatusSkipped:
+		return "skipped"
+	}
+	return ""
+}
+
+// True if the task has finished, successfully or not.
+func (self Status) Finished() bool {
+	return self >= StatusDone
+}
+
+/*
+State of one task at a point in time, as returned by `Inspect` and `Snapshot`.
+Unlike `TaskSummary`, reports raw timestamps rather than durations.
+*/
+type TaskInfo struct {
+	Task   string
+	Status Status
+
+	// Zero if the task hasn't reached the corresponding stage.
+	Created time.Time
+	Started time.Time
+	Ended   time.Time
+
+	// Short names of the tasks this task waited on, in order of waiting.
+	Deps []string
+
+	// Number of attempts made by `Retry`, or 1 for tasks that have started.
+	Attempts int
+
+	// Error of a failed or panicked task.
+	Err error
+
+	// Reason for skipping, for skipped tasks, such as "up to date". In a dry
+	// run, "would run" for tasks that would run; see `Conf.DryRun`.
+	Note string
+
+	// Output written to the writer returned by `Output`. For long outputs,
+	// only the last MiB or so; earlier lines are dropped.
+	Output string
+}
+
+/*
+Returns the current state of the given task. Works for both the "outside" view
+returned by `Start` or `TaskGroup.Task`, and the "inside" view passed to task
+functions. The boolean is false for tasks not created by Gtg.
+*/
+func Inspect(val Task) (TaskInfo, bool) {
+	switch val := val.(type) {
+	case *task:
+		return val.info(), true
+	case taskInner:
+		return val.task.info(), true
+	}
+	return TaskInfo{}, false
+}
+
+/*
+Returns the current state of every task in the group of the given task, in
+order of creation. May be called at any time, including while tasks are
+running, for example to display progress:
+
+	task := Start(ctx, SomeTask)
+	for _, val := range Snapshot(task) {
+		if val.Status == StatusRunning {
+			fmt.Println(val.Task, time.Since(val.Started))
+		}
+	}
+*/
+func Snapshot(group TaskGroup) []TaskInfo {
+	tg := groupOf(group)
+	if tg == nil {
+		return nil
+	}
+
+	tasks := tg.all()
+	out := make([]TaskInfo, 0, len(tasks))
+	for _, task := range tasks {
+		out = append(out, task.info())
+	}
+	return out
+}
@@ -0,0 +1,72 @@
+package gtg
+
+import (
+	"context"
+	"testing"
+)
+
+func TestSnapshot(t *testing.T) {
+	started := make(chan struct{})
+	block := make(chan struct{})
+	blocking := func(Task) error {
+		close(started)
+		<-block
+		return nil
+	}
+
+	var main TaskFunc = func(task Task) error {
+		MustWait(task, TaskFuncNop0)
+		MustWait(task, Unless(condTrue, TaskFuncNop1))
+		_ = Wait(task, Opt(TaskFuncImmediateErr))
+
+		eq(nil, Order(task, blocking, TaskFuncNop2))
+		task.Task(TaskFuncNop2)
+		return Wait(task, blocking)
+	}
+
+	task := Start(context.Background(), main)
+	<-started
+
+	statuses := func() map[string]Status {
+		out := map[string]Status{}
+		for _, val := range Snapshot(task) {
+			out[val.Task] = val.Status
+		}
+		return out
+	}
+
+	sts := statuses()
+	eq(StatusRunning, sts[main.ShortName()])
+	eq(StatusDone, sts["TaskFuncNop0"])
+	eq(StatusSkipped, sts["Unless(condTrue, TaskFuncNop1)"])
+	eq(StatusFailed, sts["TaskFuncImmediateErr"])
+	eq(StatusRunning, sts[TaskFunc(blocking).ShortName()])
+	eq(StatusPending, sts["TaskFuncNop2"])
+	eq(false, sts["TaskFuncNop2"].Finished())
+
+	info, ok := Inspect(task)
+	eq(true, ok)
+	eq(false, info.Started.IsZero())
+	eq(true, info.Ended.IsZero())
+	eq(nil, info.Err)
+
+	close(block)
+	waitDone(task)
+	eq(nil, task.Err())
+
+	info, ok = Inspect(task)
+	eq(true, ok)
+	eq(StatusDone, info.Status)
+	eq(true, info.Status.Finished())
+	eq(1, info.Attempts)
+	eq(false, info.Ended.Before(info.Started))
+	eq(false, info.Started.Before(info.Created))
+	eq([]string{"TaskFuncNop0", "Unless(condTrue, TaskFuncNop1)"}, info.Deps[:2])
+
+	list := Snapshot(task)
+	eq(main.ShortName(), list[0].Task)
+
+	_, ok = Inspect(nil)
+	eq(false, ok)
+	eq([]TaskInfo(nil), Snapshot(nil))
+}
@@ -7,6 +7,7 @@ import (
 	"io"
 	"reflect"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 )
@@ -23,17 +24,19 @@ func TestTaskGroup(t *testing.T) {
 		neq(nil, task1)
 		neq(nil, task2)
 
-		neq(task0, task1)
-		neq(task0, task2)
-		neq(task1, task2)
+		// Compared by identity: a deep comparison would read the state of running
+		// tasks.
+		eq(true, task0 != task1)
+		eq(true, task0 != task2)
+		eq(true, task1 != task2)
 
 		task3 := group.Task(TaskFuncNop0)
 		task5 := group.Task(TaskFuncNop2)
 		task4 := group.Task(TaskFuncNop1)
 
-		eq(task0, task3)
-		eq(task1, task4)
-		eq(task2, task5)
+		eq(true, task0 == task3)
+		eq(true, task1 == task4)
+		eq(true, task2 == task5)
 	})
 
 	t.Run("task starts immediately runs once", func(t *testing.T) {
@@ -114,6 +117,70 @@ func TestRun(t *testing.T) {
 	eq(true, errors.Is(err, context.Canceled))
 }
 
+func TestFailFast(t *testing.T) {
+	t.Run("failure cancels siblings", func(t *testing.T) {
+		var cause error
+
+		err := Conf{FailFast: true}.Run(context.Background(), func(task Task) error {
+			task.Task(TaskFuncImmediateErr)
+			return Wait(task, func(task Task) error {
+				waitDone(task)
+				cause = context.Cause(task)
+				return task.Err()
+			})
+		})
+
+		eq(true, errors.Is(err, context.Canceled))
+		eq(true, strings.Contains(cause.Error(), `immediate error`))
+	})
+
+	t.Run("optional failure doesn't cancel", func(t *testing.T) {
+		var buf strings.Builder
+		defer swapLogOutput(&buf)()
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		task := Conf{FailFast: true}.Start(ctx, func(task Task) error {
+			waitDone(task.Task(Opt(TaskFuncImmediateErr)))
+			return Wait(task, TaskFuncDoneErr)
+		})
+
+		time.Sleep(10 * time.Millisecond)
+		notDone(task)
+	})
+
+	t.Run("fallback primary doesn't cancel", func(t *testing.T) {
+		conf := Conf{FailFast: true}
+		eq(nil, conf.Run(context.Background(), Par(
+			Fallback(TaskFuncImmediateErr, TaskFuncNop0),
+			taskFuncCtxSleep,
+		)))
+	})
+
+	t.Run("failure handled by fallback doesn't cancel", func(t *testing.T) {
+		conf := Conf{FailFast: true}
+		eq(nil, conf.Run(context.Background(), Fallback(Ser(TaskFuncImmediateErr), taskFuncCtxSleep)))
+	})
+
+	t.Run("failure propagating past fallback cancels", func(t *testing.T) {
+		other := func(Task) error { return fmt.Errorf(`other error`) }
+		conf := Conf{FailFast: true}
+		err := conf.Run(context.Background(), Par(Fallback(TaskFuncImmediateErr, other), taskFuncCtxSleep))
+		neq(nil, err)
+	})
+}
+
+// Fails if the context is canceled while sleeping.
+func taskFuncCtxSleep(task Task) error {
+	select {
+	case <-task.Done():
+		return task.Err()
+	case <-time.After(10 * time.Millisecond):
+		return nil
+	}
+}
+
 func TestWait(t *testing.T) {
 	t.Run("all empty", func(t *testing.T) {
 		task := Start(context.Background(), TaskFuncNop0)
@@ -145,6 +212,482 @@ func TestOpt(t *testing.T) {
 	})
 }
 
+func TestTimeout(t *testing.T) {
+	t.Run("ignored cancellation", func(t *testing.T) {
+		block := make(chan struct{})
+		defer close(block)
+
+		err := Run(context.Background(), Timeout(time.Millisecond, TaskFuncBlock(block)))
+		eq(true, errors.Is(err, context.DeadlineExceeded))
+		eq(true, strings.Contains(err.Error(), `timed out after 1ms`))
+	})
+
+	t.Run("honored cancellation", func(t *testing.T) {
+		err := Run(context.Background(), Timeout(time.Millisecond, TaskFuncDoneErr))
+		eq(true, errors.Is(err, context.DeadlineExceeded))
+		eq(true, strings.Contains(err.Error(), `"TaskFuncDoneErr" timed out`))
+	})
+
+	t.Run("within deadline", func(t *testing.T) {
+		eq(nil, Run(context.Background(), Timeout(time.Second, TaskFuncNop0)))
+		neq(nil, Run(context.Background(), Timeout(time.Second, TaskFuncImmediateErr)))
+	})
+
+	t.Run("panic", func(t *testing.T) {
+		err := Run(context.Background(), Timeout(time.Second, func(Task) error { panic(`fail`) }))
+		eq(true, strings.Contains(err.Error(), `panicked`))
+	})
+}
+
+func TestRetry(t *testing.T) {
+	t.Run("success after failures", func(t *testing.T) {
+		var events eventLog
+		var runs int
+		fun := Retry(RetryPolicy{Attempts: 3}, func(Task) error {
+			runs++
+			if runs < 3 {
+				Must(fmt.Errorf(`attempt %v`, runs))
+			}
+			return nil
+		})
+
+		eq(nil, Conf{Observer: &events}.Run(context.Background(), fun))
+		eq(3, runs)
+
+		retries := events.filter(EventRetrying)
+		eq(2, len(retries))
+		eq(1, retries[0].Attempt)
+		eq(2, retries[1].Attempt)
+		eq(events.filter(EventStarted)[0].Task, retries[0].Task)
+	})
+
+	t.Run("attempts in task error", func(t *testing.T) {
+		err := Run(context.Background(), Retry(RetryPolicy{Attempts: 2}, TaskFuncImmediateErr))
+
+		var taskErr *TaskError
+		eq(true, errors.As(err, &taskErr))
+		eq(2, taskErr.Attempts)
+		eq(true, strings.Contains(err.Error(), `after 2 attempts: immediate error`))
+	})
+
+	t.Run("not retryable", func(t *testing.T) {
+		var runs int
+		policy := RetryPolicy{Attempts: 3, Retryable: func(error) bool { return false }}
+
+		neq(nil, Run(context.Background(), Retry(policy, func(Task) error {
+			runs++
+			return fmt.Errorf(`fail`)
+		})))
+		eq(1, runs)
+	})
+
+	t.Run("cancellation during backoff", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		go cancel()
+
+		err := Run(ctx, Retry(RetryPolicy{Attempts: 3, Delay: time.Hour}, TaskFuncImmediateErr))
+		eq(true, errors.Is(err, context.Canceled))
+		eq(true, strings.Contains(err.Error(), `immediate error`))
+	})
+
+	t.Run("backoff", func(t *testing.T) {
+		policy := RetryPolicy{Delay: 10, MaxDelay: 30}
+		eq(time.Duration(10), policy.delay(1))
+		eq(time.Duration(20), policy.delay(2))
+		eq(time.Duration(30), policy.delay(3))
+		eq(time.Duration(30), policy.delay(100))
+
+		unlimited := RetryPolicy{Delay: time.Second}
+		eq(true, unlimited.delay(100) >= unlimited.delay(30))
+		eq(true, unlimited.delay(1000) > 0)
+
+		policy.Jitter = 0.5
+		for range [16]struct{}{} {
+			delay := policy.delay(2)
+			eq(true, delay > 10 && delay <= 20)
+		}
+	})
+}
+
+func TestRace(t *testing.T) {
+	t.Run("first success cancels others", func(t *testing.T) {
+		var cause error
+		loser := func(task Task) error {
+			waitDone(task)
+			cause = context.Cause(task)
+			return task.Err()
+		}
+
+		inside(func(task Task) {
+			eq(nil, Wait(task, Race(loser, TaskFuncNop0)))
+			waitDone(task.Task(loser))
+		})
+		eq(`lost race to task "TaskFuncNop0"`, cause.Error())
+	})
+
+	t.Run("all fail", func(t *testing.T) {
+		other := func(Task) error { return fmt.Errorf(`other error`) }
+
+		err := Run(context.Background(), Race(TaskFuncImmediateErr, other))
+		eq(true, strings.Contains(err.Error(), `immediate error`))
+		eq(true, strings.Contains(err.Error(), `other error`))
+	})
+
+	t.Run("empty", func(t *testing.T) {
+		eq(nil, Run(context.Background(), Race()))
+	})
+
+	t.Run("fail fast", func(t *testing.T) {
+		conf := Conf{FailFast: true}
+		eq(nil, conf.Run(context.Background(), Race(TaskFuncImmediateErr, taskFuncCtxSleep)))
+
+		// The loser fails after being canceled, which doesn't cancel the group.
+		eq(nil, conf.Run(context.Background(), Par(Race(TaskFuncDoneErr, TaskFuncNop0), taskFuncCtxSleep)))
+
+		err := conf.Run(context.Background(), Race(TaskFuncImmediateErr))
+		eq(true, strings.Contains(err.Error(), `immediate error`))
+	})
+}
+
+func TestFirst(t *testing.T) {
+	t.Run("losers keep running", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		inside(func(task Task) {
+			eq(nil, Wait(task, First(TaskFuncImmediateErr, TaskFuncNop0)))
+
+			loser := Start(ctx, func(task Task) error {
+				eq(nil, Wait(task, First(TaskFuncDoneErr, TaskFuncNop0)))
+				return nil
+			})
+			waitDone(loser)
+			eq(nil, loser.Err())
+			notDone(loser.Task(TaskFuncDoneErr))
+		})
+	})
+
+	t.Run("fail fast", func(t *testing.T) {
+		conf := Conf{FailFast: true}
+		eq(nil, conf.Run(context.Background(), First(TaskFuncImmediateErr, taskFuncCtxSleep)))
+	})
+}
+
+func TestIf(t *testing.T) {
+	t.Run("naming and deduplication", func(t *testing.T) {
+		fun := If(condTrue, TaskFuncNop0)
+		eq("If(condTrue, TaskFuncNop0)", fun.ShortName())
+		eq(fun.id(), If(condTrue, TaskFuncNop0).id())
+		neq(fun.id(), Unless(condTrue, TaskFuncNop0).id())
+		eq("Unless(condTrue, TaskFuncNop0)", Unless(condTrue, TaskFuncNop0).ShortName())
+	})
+
+	t.Run("true", func(t *testing.T) {
+		task := Start(context.Background(), If(condTrue, TaskFuncImmediateErr))
+		waitDone(task)
+		neq(nil, task.Err())
+		eq(true, strings.Contains(task.Err().Error(), `task "If(condTrue, TaskFuncImmediateErr)" erred`))
+	})
+
+	t.Run("false", func(t *testing.T) {
+		var events eventLog
+		task := Conf{Observer: &events}.Start(context.Background(), Unless(condTrue, TaskFuncImmediateErr))
+		waitDone(task)
+		eq(nil, task.Err())
+		eq(1, len(Summarize(task).Tasks))
+
+		skipped := events.filter(EventSkipped)
+		eq(1, len(skipped))
+		eq("Unless(condTrue, TaskFuncImmediateErr)", skipped[0].Task)
+		eq(`Unless(condTrue, TaskFuncImmediateErr): condition condTrue is true`, skipped[0].Msg)
+	})
+}
+
+func TestFallback(t *testing.T) {
+	eq("Fallback(TaskFuncImmediateErr, TaskFuncNop0)", Fallback(TaskFuncImmediateErr, TaskFuncNop0).ShortName())
+
+	t.Run("primary fails", func(t *testing.T) {
+		var events eventLog
+		conf := Conf{Observer: &events, FailFast: true}
+		eq(nil, conf.Run(context.Background(), Fallback(TaskFuncImmediateErr, TaskFuncNop0)))
+
+		fallbacks := events.filter(EventFallback)
+		eq(1, len(fallbacks))
+		eq("TaskFuncImmediateErr", fallbacks[0].Task)
+		eq("TaskFuncNop0", fallbacks[0].Dep)
+	})
+
+	t.Run("primary succeeds", func(t *testing.T) {
+		task := Start(context.Background(), Fallback(TaskFuncNop0, TaskFuncImmediateErr))
+		waitDone(task)
+		eq(nil, task.Err())
+		eq(2, len(Summarize(task).Tasks))
+	})
+
+	t.Run("both fail", func(t *testing.T) {
+		other := func(Task) error { return fmt.Errorf(`other error`) }
+		err := Run(context.Background(), Fallback(TaskFuncImmediateErr, other))
+		eq(true, strings.Contains(err.Error(), `other error`))
+	})
+}
+
+func TestMatrix(t *testing.T) {
+	t.Run("naming and deduplication", func(t *testing.T) {
+		cell := Cell(matrixTemplate, "linux/amd64")
+		eq("matrixTemplate[linux/amd64]", cell.ShortName())
+		eq(cell.id(), Cell(matrixTemplate, "linux/amd64").id())
+		neq(cell.id(), Cell(matrixTemplate, "darwin/arm64").id())
+
+		fun, err := Choose([]string{"matrixTemplate[darwin/arm64]"}, Cells(matrixTemplate, "linux/amd64", "darwin/arm64"))
+		eq(nil, err)
+		eq(Cell(matrixTemplate, "darwin/arm64").id(), fun.id())
+	})
+
+	t.Run("all cells run once", func(t *testing.T) {
+		task := Start(context.Background(), func(task Task) error {
+			MustWait(task, Matrix(matrixTemplate, "one", "two"))
+			return Wait(task, Cell(matrixTemplate, "one"))
+		})
+		waitDone(task)
+		eq(nil, task.Err())
+
+		var names []string
+		for _, val := range Summarize(task).Tasks {
+			names = append(names, val.Task)
+		}
+		eq(true, strings.Contains(strings.Join(names, " "), "matrixTemplate[one]"))
+		eq(4, len(names))
+	})
+
+	t.Run("first failure", func(t *testing.T) {
+		block := make(chan struct{})
+		defer close(block)
+
+		slow := func(_ Task, param string) error {
+			if param == "fail" {
+				return fmt.Errorf(`failed for %v`, param)
+			}
+			<-block
+			return nil
+		}
+
+		err := Run(context.Background(), Matrix(slow, "one", "fail"))
+		eq(true, strings.Contains(err.Error(), `failed for fail`))
+	})
+
+	t.Run("all failed cells", func(t *testing.T) {
+		err := Run(context.Background(), MatrixAll(matrixTemplate, "one", "fail", "two", "fail too"))
+		eq(true, strings.HasPrefix(err.Error(), `task "MatrixAll(matrixTemplate[one], matrixTemplate[fail], matrixTemplate[two], matrixTemplate[fail too])" erred: 2 of 4 cells failed`))
+		eq(true, strings.Contains(err.Error(), `task "matrixTemplate[fail]" erred`))
+		eq(true, strings.Contains(err.Error(), `task "matrixTemplate[fail too]" erred`))
+	})
+}
+
+func matrixTemplate(_ Task, param string) error {
+	if strings.HasPrefix(param, "fail") {
+		return fmt.Errorf(`failed for %v`, param)
+	}
+	return nil
+}
+
+func TestMiddleware(t *testing.T) {
+	var calls []string
+	var lock sync.Mutex
+
+	record := func(val string) {
+		lock.Lock()
+		calls = append(calls, val)
+		lock.Unlock()
+	}
+
+	outer := func(name string, fun TaskFunc) TaskFunc {
+		return func(task Task) error {
+			record("outer:" + name)
+			return fun(task)
+		}
+	}
+
+	inner := func(name string, fun TaskFunc) TaskFunc {
+		return func(task Task) error {
+			record("inner:" + name)
+			return fun(task)
+		}
+	}
+
+	conf := Conf{Middleware: []Middleware{outer, nil, inner}}
+	task := conf.Start(context.Background(), func(task Task) error {
+		MustWait(task, TaskFuncNop0)
+		return Wait(task, TaskFuncNop0)
+	})
+	waitDone(task)
+	eq(nil, task.Err())
+
+	eq(4, len(calls))
+	eq(true, strings.HasPrefix(calls[0], "outer:func"))
+	eq(true, strings.HasPrefix(calls[1], "inner:func"))
+	eq([]string{"outer:TaskFuncNop0", "inner:TaskFuncNop0"}, calls[2:])
+
+	t.Run("subgroup names", func(t *testing.T) {
+		var names []string
+		conf := Conf{Middleware: []Middleware{func(name string, fun TaskFunc) TaskFunc {
+			lock.Lock()
+			names = append(names, name)
+			lock.Unlock()
+			return fun
+		}}}
+
+		task := conf.Start(context.Background(), func(task Task) error {
+			return Wait(Sub(task, "one"), TaskFuncNop0)
+		})
+		waitDone(task)
+		eq(nil, task.Err())
+
+		lock.Lock()
+		defer lock.Unlock()
+		eq(2, len(names))
+		eq(true, names[0] == "one/TaskFuncNop0" || names[1] == "one/TaskFuncNop0")
+	})
+
+	sum := Summarize(task)
+	eq(2, len(sum.Tasks))
+	eq(true, sum.Tasks[0].Task == "TaskFuncNop0" || sum.Tasks[1].Task == "TaskFuncNop0")
+}
+
+func TestWaitAll(t *testing.T) {
+	t.Run("waits for tasks nothing waits on", func(t *testing.T) {
+		var done bool
+		cleanup := func(Task) error {
+			time.Sleep(10 * time.Millisecond)
+			done = true
+			return nil
+		}
+
+		err := Conf{Drain: time.Second}.Run(context.Background(), func(task Task) error {
+			task.Task(func(task Task) error {
+				task.Task(cleanup)
+				return nil
+			})
+			return nil
+		})
+		eq(nil, err)
+		eq(true, done)
+	})
+
+	t.Run("timeout", func(t *testing.T) {
+		block := make(chan struct{})
+		blocking := TaskFuncBlock(block)
+
+		task := Start(context.Background(), func(task Task) error {
+			task.Task(blocking)
+			return nil
+		})
+		waitDone(task)
+
+		err := WaitAll(task, 10*time.Millisecond)
+		neq(nil, err)
+		eq(true, strings.HasPrefix(err.Error(), `1 tasks still running after 10ms: "`))
+
+		close(block)
+		eq(nil, WaitAll(task, 0))
+	})
+
+	t.Run("drain timeout is logged", func(t *testing.T) {
+		block := make(chan struct{})
+		defer close(block)
+
+		var events eventLog
+		err := Conf{Observer: &events, Drain: 10 * time.Millisecond}.Run(context.Background(), func(task Task) error {
+			task.Task(TaskFuncBlock(block))
+			return nil
+		})
+		eq(nil, err)
+
+		logged := events.filter(EventError)
+		eq(1, len(logged))
+		eq(true, strings.Contains(logged[0].Err.Error(), "1 tasks still running"))
+	})
+
+	neq(nil, WaitAll(nil, 0))
+}
+
+func TestSub(t *testing.T) {
+	var lock sync.Mutex
+	runs := map[string]int{}
+	count := func(name string) TaskFunc {
+		return func(Task) error {
+			lock.Lock()
+			runs[name]++
+			lock.Unlock()
+			return nil
+		}
+	}
+
+	setup := count("setup")
+	build := count("build")
+	pipeline := func(task Task) error {
+		MustWait(task, setup)
+		return Wait(task, build)
+	}
+
+	var events eventLog
+	task := Conf{Observer: &events}.Start(context.Background(), func(task Task) error {
+		MustWait(task, build)
+
+		one := Sub(task, "one", setup)
+		two := Sub(task, "two", setup)
+		MustWait(one, pipeline)
+		MustWait(two, pipeline)
+		MustWait(one, pipeline)
+
+		nested := Sub(one.Task(pipeline), "nested")
+		return Wait(nested, build)
+	})
+	waitDone(task)
+	eq(nil, task.Err())
+
+	eq(map[string]int{"setup": 1, "build": 4}, runs)
+
+	var names []string
+	for _, val := range Snapshot(task) {
+		names = append(names, val.Task)
+	}
+	eq(8, len(names))
+	eq(true, strings.Contains(strings.Join(names, " "), "one/nested/"))
+
+	created := events.filter(EventCreated)
+	eq(8, len(created))
+	eq(true, strings.HasPrefix(created[2].Task, "one/"))
+
+	t.Run("context outlives the given task", func(t *testing.T) {
+		var group TaskGroup
+		task := Start(context.Background(), func(task Task) error {
+			group = Sub(task, "one")
+			return nil
+		})
+		waitDone(task)
+
+		eq(nil, Wait(group, func(task Task) error { return task.Err() }))
+		eq(nil, Wait(Sub(group.Task(TaskFuncNop0), "nested"), func(task Task) error { return task.Err() }))
+	})
+
+	t.Run("fail fast", func(t *testing.T) {
+		var cause error
+		conf := Conf{FailFast: true}
+		eq(nil, conf.Run(context.Background(), func(task Task) error {
+			group := Sub(task, "one")
+			group.Task(TaskFuncImmediateErr)
+
+			waitDone(group.Task(func(task Task) error {
+				waitDone(task)
+				cause = context.Cause(task)
+				return nil
+			}))
+			return Wait(task, taskFuncCtxSleep)
+		}))
+		eq(true, strings.Contains(cause.Error(), `immediate error`))
+	})
+}
+
 /*
 TODO:
 
@@ -178,6 +721,83 @@ func TestPar(t *testing.T) {
 	t.Skip()
 }
 
+func TestOrder(t *testing.T) {
+	t.Run("concurrent request waits on predecessor", func(t *testing.T) {
+		var firstEnd, secondStart time.Time
+
+		first := func(Task) error {
+			time.Sleep(10 * time.Millisecond)
+			firstEnd = time.Now()
+			return nil
+		}
+		second := func(Task) error {
+			secondStart = time.Now()
+			return nil
+		}
+
+		inside(func(task Task) {
+			eq(nil, Order(task, first, second))
+			eq(nil, Wait(task, Par(second, first)))
+		})
+		eq(false, secondStart.Before(firstEnd))
+	})
+
+	t.Run("predecessor failure", func(t *testing.T) {
+		var runs int
+		second := func(Task) error {
+			runs++
+			return nil
+		}
+
+		inside(func(task Task) {
+			eq(nil, Order(task, TaskFuncImmediateErr, second))
+			err := Wait(task, second)
+			neq(nil, err)
+			eq(true, strings.Contains(err.Error(), "prerequisite failed"))
+		})
+		eq(0, runs)
+	})
+
+	t.Run("already started out of order", func(t *testing.T) {
+		inside(func(task Task) {
+			waitDone(task.Task(TaskFuncNop1))
+			neq(nil, Order(task, TaskFuncNop0, TaskFuncNop1))
+		})
+	})
+
+	t.Run("cycle", func(t *testing.T) {
+		inside(func(task Task) {
+			eq(nil, Order(task, TaskFuncNop0, TaskFuncNop1, TaskFuncNop2))
+
+			err := Order(task, TaskFuncNop2, TaskFuncNop0)
+			neq(nil, err)
+			eq(`ordering cycle: TaskFuncNop0 -> TaskFuncNop2 -> TaskFuncNop1 -> TaskFuncNop0`, err.Error())
+
+			err = Order(task, TaskFuncNop1, TaskFuncNop1)
+			neq(nil, err)
+			eq(`ordering cycle: TaskFuncNop1 -> TaskFuncNop1`, err.Error())
+
+			// The rejected constraints don't prevent the tasks from running.
+			eq(nil, Wait(task, TaskFuncNop2))
+		})
+	})
+
+	t.Run("ordered combinator", func(t *testing.T) {
+		var order []string
+		first := func(Task) error {
+			order = append(order, "first")
+			return nil
+		}
+		second := func(Task) error {
+			order = append(order, "second")
+			return nil
+		}
+
+		eq(nil, Run(context.Background(), Ordered(first, second)))
+		eq([]string{"first", "second"}, order)
+	})
+}
+
 func TaskFuncNop0(Task) error { return nil }
 
 func TaskFuncNop1(Task) error { return nil }
@@ -193,6 +813,16 @@ func TaskFuncImmediateErr(Task) error {
 	return fmt.Errorf(`immediate error`)
 }
 
+func condTrue(Task) bool { return true }
+
+// Ignores cancellation, blocking until the channel is closed.
+func TaskFuncBlock(block chan struct{}) TaskFunc {
+	return func(Task) error {
+		<-block
+		return nil
+	}
+}
+
 func eq(expected interface{}, actual interface{}) {
 	if !reflect.DeepEqual(expected, actual) {
 		panic(fmt.Errorf(`
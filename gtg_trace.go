@@ -0,0 +1,154 @@
+package gtg
+
+import (
+	"encoding/json"
+	"io"
+	"sort"
+	"strconv"
+	"time"
+)
+
+/*
+Writes the tasks of the given group in the Chrome Trace Event JSON format, which
+can be opened in "chrome://tracing" or https://ui.perfetto.dev. Should be used
+after the run is finished; tasks that haven't started are omitted, and running
+tasks end at the current time.
+
+Each task is a span with its status and error, if any. Gtg doesn't pin tasks to
+goroutines, so spans are laid out in lanes: each span goes into the first lane
+free at the time of its start. Waits between tasks are flow arrows, from the end
+of the awaited task to the waiting task.
+
+CLI scripts can use the "--trace=<file>" flag of `RunCmd`; see `Conf.Trace`.
+*/
+func WriteTrace(out io.Writer, group TaskGroup) error {
+	var events []traceEvent
+	tg := groupOf(group)
+	if tg != nil {
+		events = traceEvents(tg.all())
+	}
+
+	return json.NewEncoder(out).Encode(struct {
+		TraceEvents     []traceEvent `json:"traceEvents"`
+		DisplayTimeUnit string       `json:"displayTimeUnit"`
+	}{events, "ms"})
+}
+
+// See https://docs.google.com/document/d/1CvAClvFfyA5R-PhYUmn5OOQtYMH4h6I0nSsKchNAySU.
+type traceEvent struct {
+	Name string                 `json:"name"`
+	Cat  string                 `json:"cat,omitempty"`
+	Ph   string                 `json:"ph"`
+	Ts   float64                `json:"ts"`
+	Dur  float64                `json:"dur,omitempty"`
+	Pid  int                    `json:"pid"`
+	Tid  int                    `json:"tid"`
+	ID   int                    `json:"id,omitempty"`
+	Bp   string                 `json:"bp,omitempty"`
+	Args map[string]interface{} `json:"args,omitempty"`
+}
+
+type traceSpan struct {
+	task  *task
+	start time.Time
+	end   time.Time
+	lane  int
+}
+
+func traceEvents(tasks []*task) []traceEvent {
+	var spans []*traceSpan
+	var origin time.Time
+	index := map[*task]*traceSpan{}
+
+	for _, task := range tasks {
+		created, start, end := task.times()
+		if origin.IsZero() || created.Before(origin) {
+			origin = created
+		}
+		if start.IsZero() {
+			continue
+		}
+		span := &traceSpan{task: task, start: start, end: end}
+		spans = append(spans, span)
+		index[task] = span
+	}
+
+	sort.SliceStable(spans, func(one, two int) bool {
+		return spans[one].start.Before(spans[two].start)
+	})
+
+	var laneEnds []time.Time
+	for _, span := range spans {
+		span.lane = -1
+		for ind, end := range laneEnds {
+			if !end.After(span.start) {
+				span.lane = ind
+				break
+			}
+		}
+		if span.lane < 0 {
+			span.lane = len(laneEnds)
+			laneEnds = append(laneEnds, time.Time{})
+		}
+		laneEnds[span.lane] = span.end
+	}
+
+	micros := func(val time.Time) float64 {
+		return float64(val.Sub(origin)) / float64(time.Microsecond)
+	}
+
+	out := []traceEvent{{
+		Name: "process_name", Ph: "M", Pid: 1,
+		Args: map[string]interface{}{"name": "gtg"},
+	}}
+
+	for ind := range laneEnds {
+		out = append(out, traceEvent{
+			Name: "thread_name", Ph: "M", Pid: 1, Tid: ind + 1,
+			Args: map[string]interface{}{"name": "lane " + strconv.Itoa(ind+1)},
+		})
+	}
+
+	for _, span := range spans {
+		sum := span.task.summary()
+		args := map[string]interface{}{"status": sum.Status.String()}
+		if sum.Err != nil {
+			args["error"] = sum.Err.Error()
+		}
+
+		out = append(out, traceEvent{
+			Name: sum.Task, Cat: "task", Ph: "X",
+			Ts: micros(span.start), Dur: micros(span.end) - micros(span.start),
+			Pid: 1, Tid: span.lane + 1, Args: args,
+		})
+	}
+
+	var flowID int
+	for _, span := range spans {
+		for _, dep := range span.task.depList() {
+			depSpan := index[dep]
+			if depSpan == nil {
+				continue
+			}
+
+			flowID++
+			from := depSpan.end
+			to := from
+			if to.Before(span.start) {
+				to = span.start
+			}
+
+			out = append(out,
+				traceEvent{
+					Name: "wait", Cat: "wait", Ph: "s", ID: flowID,
+					Ts: micros(from), Pid: 1, Tid: depSpan.lane + 1,
+				},
+				traceEvent{
+					Name: "wait", Cat: "wait", Ph: "f", Bp: "e", ID: flowID,
+					Ts: micros(to), Pid: 1, Tid: span.lane + 1,
+				},
+			)
+		}
+	}
+	return out
+}
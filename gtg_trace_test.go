@@ -0,0 +1,39 @@
+package gtg
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestWriteTrace(t *testing.T) {
+	task := Start(context.Background(), TaskFuncPathMain)
+	waitDone(task)
+
+	var buf strings.Builder
+	eq(nil, WriteTrace(&buf, task))
+
+	var out struct {
+		TraceEvents []traceEvent `json:"traceEvents"`
+	}
+	eq(nil, json.Unmarshal([]byte(buf.String()), &out))
+
+	spans := map[string]traceEvent{}
+	phases := map[string]int{}
+	for _, val := range out.TraceEvents {
+		phases[val.Ph]++
+		if val.Ph == "X" {
+			spans[val.Name] = val
+		}
+	}
+
+	eq(map[string]int{"M": 4, "X": 3, "s": 2, "f": 2}, phases)
+	eq("done", spans["TaskFuncPathMain"].Args["status"])
+	eq(true, spans["TaskFuncPathSlow"].Dur >= 30000)
+
+	// Main task and both of its concurrent dependencies need separate lanes.
+	neq(spans["TaskFuncPathSlow"].Tid, spans["TaskFuncPathMain"].Tid)
+	neq(spans["TaskFuncPathFast"].Tid, spans["TaskFuncPathMain"].Tid)
+	neq(spans["TaskFuncPathFast"].Tid, spans["TaskFuncPathSlow"].Tid)
+}
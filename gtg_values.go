@@ -0,0 +1,164 @@
+package gtg
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+)
+
+/*
+A value available to all tasks in a group, identified by its type. Created by
+`Provide` or `ProvideFunc`, and added to a group via `Conf.Values` or
+`AddValues`. Tasks get values via `Get`.
+
+Because values are identified by type, shared configuration should use
+dedicated types:
+
+	type ProjectRoot string
+
+	conf := Conf{Values: []Provider{
+		Provide(ProjectRoot("/path/to/project")),
+		ProvideFunc(connectDb),
+	}}
+*/
+type Provider struct {
+	typ  reflect.Type
+	val  interface{}
+	lazy func(Task) (interface{}, error)
+}
+
+// Provides the given value to tasks that `Get` its type.
+func Provide[T any](val T) Provider {
+	return Provider{typ: typeOf[T](), val: val}
+}
+
+/*
+Provides a value computed by the given function, at most once per group, the
+first time a task calls `Get` for its type. The function runs as a task of the
+group, named after the type, as in "Provide(*sql.DB)", and shows up in reports
+like any other. Its error is returned by `Get`.
+*/
+func ProvideFunc[T any](fun func(Task) (T, error)) Provider {
+	return Provider{
+		typ: typeOf[T](),
+		lazy: func(task Task) (interface{}, error) {
+			return fun(task)
+		},
+	}
+}
+
+/*
+Adds values to the group of the given task or group, replacing values of the
+same types. Mostly useful for subgroups created by `Sub`, and for tests. Values
+are best added before starting the tasks that use them.
+*/
+func AddValues(group TaskGroup, vals ...Provider) error {
+	tg := groupOf(group)
+	if tg == nil {
+		return fmt.Errorf(`can't add values to unknown task group %T`, group)
+	}
+	tg.addValues(vals)
+	return nil
+}
+
+/*
+Returns the value of the given type, provided to the group of the given task via
+`Conf.Values` or `AddValues`. Values of subgroups take priority over values of
+their parent groups. Usage:
+
+	func Build(task Task) error {
+		root, err := Get[ProjectRoot](task)
+		if err != nil {
+			return err
+		}
+		return exec.CommandContext(task, "go", "build", string(root)).Run()
+	}
+
+For values provided via `ProvideFunc`, waits for the provider task, which
+counts as waiting on it. Like with `Wait`, a failure of the provider is returned
+to the caller, and doesn't cancel the group under `Conf.FailFast`.
+*/
+func Get[T any](task Task) (T, error) {
+	var out T
+	typ := typeOf[T]()
+
+	tg := groupOf(task)
+	if tg == nil {
+		return out, fmt.Errorf(`can't get value of type %v from unknown task group %T`, typ, task)
+	}
+
+	owner, entry := tg.value(typ)
+	if entry == nil {
+		return out, fmt.Errorf(`no value of type %v in task group`, typ)
+	}
+
+	if entry.fun != nil {
+		dep := owner.start(entry.fun, true)
+		done := waiting(task, dep)
+		err := waitFor(dep)
+		done()
+		if err != nil {
+			return out, err
+		}
+	}
+
+	val, _ := entry.get().(T)
+	return val, nil
+}
+
+// Shortcut for `Must(Get())`.
+func MustGet[T any](task Task) T {
+	val, err := Get[T](task)
+	Must(err)
+	return val
+}
+
+func typeOf[T any]() reflect.Type {
+	return reflect.TypeOf((*T)(nil)).Elem()
+}
+
+// Value stored in a group. See `Provider`.
+type groupValue struct {
+	lock sync.Mutex
+	val  interface{}
+	lazy func(Task) (interface{}, error)
+
+	// Provider task function, for lazy values.
+	fun TaskFunc
+}
+
+func (self *groupValue) get() interface{} {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	return self.val
+}
+
+func (self *groupValue) set(val interface{}) {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	self.val = val
+}
+
+/*
+Task function that computes a lazy value for the group it runs in. Doesn't refer
+to any particular group, which allows to share it between groups.
+*/
+func providerTask(typ reflect.Type) TaskFunc {
+	name := fmt.Sprintf(`Provide(%v)`, typ)
+	id := reflect.ValueOf(typ).Pointer()
+
+	return derive(name, []uintptr{id}, func(task Task) error {
+		tg := groupOf(task)
+		entry := tg.ownValue(typ)
+		if entry == nil || entry.lazy == nil {
+			return fmt.Errorf(`no provider of type %v in task group`, typ)
+		}
+
+		val, err := entry.lazy(task)
+		if err != nil {
+			return err
+		}
+		entry.set(val)
+		return nil
+	})
+}
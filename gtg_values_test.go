@@ -0,0 +1,105 @@
+package gtg
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync/atomic"
+	"testing"
+)
+
+type testRoot string
+
+type testDb struct{ name string }
+
+func TestValues(t *testing.T) {
+	t.Run("eager and lazy", func(t *testing.T) {
+		var connects int32
+		connect := func(task Task) (*testDb, error) {
+			atomic.AddInt32(&connects, 1)
+			root, err := Get[testRoot](task)
+			return &testDb{name: string(root) + "/db"}, err
+		}
+
+		conf := Conf{Values: []Provider{
+			Provide(testRoot("/project")),
+			ProvideFunc(connect),
+		}}
+
+		task := conf.Start(context.Background(), func(task Task) error {
+			eq(testRoot("/project"), MustGet[testRoot](task))
+
+			_, err := Get[int](task)
+			eq("no value of type int in task group", err.Error())
+
+			return Par(
+				func(task Task) error {
+					eq("/project/db", MustGet[*testDb](task).name)
+					return nil
+				},
+				func(task Task) error {
+					eq("/project/db", MustGet[*testDb](task).name)
+					return nil
+				},
+			)(task)
+		})
+		waitDone(task)
+		eq(nil, task.Err())
+		eq(int32(1), atomic.LoadInt32(&connects))
+
+		var names []string
+		for _, val := range Snapshot(task) {
+			names = append(names, val.Task)
+		}
+		eq(4, len(names))
+		eq(true, slices.Contains(names, "Provide(*gtg.testDb)"))
+	})
+
+	t.Run("provider error", func(t *testing.T) {
+		errNoDb := errors.New(`no database`)
+		fail := func(Task) (*testDb, error) { return nil, errNoDb }
+
+		task := Conf{Values: []Provider{ProvideFunc(fail)}}.Start(context.Background(), func(task Task) error {
+			_, err := Get[*testDb](task)
+			return err
+		})
+		waitDone(task)
+		eq(true, errors.Is(task.Err(), errNoDb))
+	})
+
+	t.Run("provider error with fail fast", func(t *testing.T) {
+		fail := func(Task) (*testDb, error) { return nil, errors.New(`no database`) }
+		conf := Conf{FailFast: true, Values: []Provider{ProvideFunc(fail)}}
+
+		var cause error
+		eq(nil, conf.Run(context.Background(), func(task Task) error {
+			_, err := Get[*testDb](task)
+			neq(nil, err)
+			cause = context.Cause(task)
+			return nil
+		}))
+		eq(nil, cause)
+	})
+
+	t.Run("subgroups", func(t *testing.T) {
+		task := Conf{Values: []Provider{Provide(testRoot("parent"))}}.Start(context.Background(), func(task Task) error {
+			inherit := Sub(task, "inherit")
+			override := Sub(task, "override")
+			Must(AddValues(override, Provide(testRoot("child"))))
+
+			read := func(task Task) error {
+				_, err := Get[testRoot](task)
+				return err
+			}
+			MustWait(inherit, read)
+			MustWait(override, read)
+
+			eq(testRoot("parent"), MustGet[testRoot](inherit.Task(read)))
+			eq(testRoot("child"), MustGet[testRoot](override.Task(read)))
+			eq(testRoot("parent"), MustGet[testRoot](task))
+			return nil
+		})
+		waitDone(task)
+		eq(nil, task.Err())
+	})
+}
@@ -0,0 +1,282 @@
+/*
+Helpers for testing task graphs built with "github.com/mitranim/gtg". Runs a
+task function in a new group, recording every event and the final state of
+every task, and provides assertions about which tasks ran, how many times, in
+which order, with which errors, and which tasks waited on which. Usage:
+
+	func TestBuild(t *testing.T) {
+		rec := gtgtest.Run(t, Build)
+		rec.AssertRuns(t, "Compile", 1)
+		rec.AssertOrder(t, "Generate", "Compile")
+		rec.AssertErr(t, "Lint", ErrLint)
+		rec.AssertEdge(t, "Build", "Compile")
+	}
+
+Tasks are identified by their names, as reported by `gtg.TaskInfo`; tasks of
+subgroups are prefixed with the names of their subgroups.
+*/
+package gtgtest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mitranim/gtg"
+)
+
+/*
+Used by `Run` and `RunConf` when `gtg.Conf.Drain` is zero: how long to wait for
+tasks left running after the main task finishes.
+*/
+const DefaultDrain = 5 * time.Second
+
+// Result of `Run` or `RunConf`.
+type Recording struct {
+	// Error of the main task.
+	Err error
+
+	// Every event of the group, in order of delivery.
+	Events []gtg.Event
+
+	// State of every task in the group after the run, in order of creation.
+	Tasks []gtg.TaskInfo
+}
+
+// A task waited on another. See `Recording.Edges`.
+type Edge struct {
+	From string
+	To   string
+}
+
+// Shortcut for `RunConf` with an empty `gtg.Conf`.
+func Run(t testing.TB, fun gtg.TaskFunc) *Recording {
+	t.Helper()
+	return RunConf(t, gtg.Conf{}, fun)
+}
+
+/*
+Runs the task function as the main task of a new group with the given
+configuration, and records the run. Events are delivered to the configured
+observer, if any, as well as recorded. After the main task finishes, cancels the
+group's context and waits for other tasks, up to `gtg.Conf.Drain` or
+`DefaultDrain`, failing the test if any are still running.
+*/
+func RunConf(t testing.TB, conf gtg.Conf, fun gtg.TaskFunc) *Recording {
+	t.Helper()
+
+	var rec recorder
+	if conf.Observer == nil {
+		conf.Observer = &rec
+	} else {
+		conf.Observer = gtg.Observers{conf.Observer, &rec}
+	}
+
+	drain := conf.Drain
+	if drain == 0 {
+		drain = DefaultDrain
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	main := conf.Start(ctx, fun)
+	<-main.Done()
+	cancel()
+
+	if drain > 0 {
+		err := gtg.WaitAll(main, drain)
+		if err != nil {
+			t.Errorf(`%v`, err)
+		}
+	}
+
+	return &Recording{
+		Err:    main.Err(),
+		Events: rec.list(),
+		Tasks:  gtg.Snapshot(main),
+	}
+}
+
+// Returns the state of the task with the given name.
+func (self *Recording) Task(name string) (gtg.TaskInfo, bool) {
+	for _, val := range self.Tasks {
+		if val.Task == name {
+			return val, true
+		}
+	}
+	return gtg.TaskInfo{}, false
+}
+
+/*
+How many times the function of the given task was called, counting attempts
+made by `gtg.Retry`. Zero for tasks that didn't start, including tasks that
+were skipped.
+*/
+func (self *Recording) Runs(name string) int {
+	var out int
+	for _, val := range self.Events {
+		if val.Task == name && (val.Kind == gtg.EventStarted || val.Kind == gtg.EventRetrying) {
+			out++
+		}
+	}
+	return out
+}
+
+// Which tasks waited on which, in order of waiting, without duplicates.
+func (self *Recording) Edges() []Edge {
+	var out []Edge
+	seen := map[Edge]bool{}
+	for _, val := range self.Events {
+		if val.Kind != gtg.EventWaiting {
+			continue
+		}
+		edge := Edge{val.Task, val.Dep}
+		if !seen[edge] {
+			seen[edge] = true
+			out = append(out, edge)
+		}
+	}
+	return out
+}
+
+// Fails the test unless every given task ran at least once.
+func (self *Recording) AssertRan(t testing.TB, names ...string) {
+	t.Helper()
+	for _, name := range names {
+		if self.Runs(name) == 0 {
+			t.Errorf(`expected task %q to run; %v`, name, self.known())
+		}
+	}
+}
+
+// Fails the test if any given task ran.
+func (self *Recording) AssertNotRan(t testing.TB, names ...string) {
+	t.Helper()
+	for _, name := range names {
+		if count := self.Runs(name); count > 0 {
+			t.Errorf(`expected task %q not to run, but it ran %v times`, name, count)
+		}
+	}
+}
+
+// Fails the test unless the task ran exactly the given number of times.
+func (self *Recording) AssertRuns(t testing.TB, name string, expected int) {
+	t.Helper()
+	if count := self.Runs(name); count != expected {
+		t.Errorf(`expected task %q to run %v times, but it ran %v times`, name, expected, count)
+	}
+}
+
+/*
+Fails the test unless every given task finished before the next one started.
+Tasks that didn't run fail the assertion.
+*/
+func (self *Recording) AssertOrder(t testing.TB, names ...string) {
+	t.Helper()
+
+	var tasks []gtg.TaskInfo
+	for _, name := range names {
+		val, ok := self.started(name)
+		if !ok {
+			t.Errorf(`expected task %q to run; %v`, name, self.known())
+			return
+		}
+		tasks = append(tasks, val)
+	}
+
+	for ind := 1; ind < len(tasks); ind++ {
+		prev, next := tasks[ind-1], tasks[ind]
+		if next.Started.Before(prev.Ended) {
+			t.Errorf(`expected task %q to finish before task %q started`, prev.Task, next.Task)
+		}
+	}
+}
+
+// Fails the test unless the task finished with the given status.
+func (self *Recording) AssertStatus(t testing.TB, name string, expected gtg.Status) {
+	t.Helper()
+	val, ok := self.Task(name)
+	if !ok {
+		t.Errorf(`expected task %q to exist; %v`, name, self.known())
+		return
+	}
+	if val.Status != expected {
+		t.Errorf(`expected task %q to be %v, but it's %v`, name, expected, val.Status)
+	}
+}
+
+/*
+Fails the test unless the error of the task matches the target via
+`errors.Is`. A nil target means the task must have succeeded, or been skipped.
+Tasks that didn't finish fail the assertion.
+*/
+func (self *Recording) AssertErr(t testing.TB, name string, target error) {
+	t.Helper()
+	val, ok := self.Task(name)
+	if !ok {
+		t.Errorf(`expected task %q to exist; %v`, name, self.known())
+		return
+	}
+	if !val.Status.Finished() {
+		t.Errorf(`expected task %q to finish, but it's %v`, name, val.Status)
+		return
+	}
+
+	if target == nil {
+		if val.Err != nil {
+			t.Errorf(`expected task %q to succeed, but it failed: %v`, name, val.Err)
+		}
+		return
+	}
+	if !errors.Is(val.Err, target) {
+		t.Errorf(`expected error of task %q to match %q, got: %v`, name, target, val.Err)
+	}
+}
+
+// Fails the test unless the first task waited on the second.
+func (self *Recording) AssertEdge(t testing.TB, from, to string) {
+	t.Helper()
+	for _, val := range self.Edges() {
+		if val == (Edge{from, to}) {
+			return
+		}
+	}
+	t.Errorf(`expected task %q to wait on task %q; recorded edges: %v`, from, to, self.Edges())
+}
+
+func (self *Recording) started(name string) (gtg.TaskInfo, bool) {
+	val, ok := self.Task(name)
+	return val, ok && self.Runs(name) > 0
+}
+
+// Describes the known tasks, sorted by name, for error messages.
+func (self *Recording) known() string {
+	var names []string
+	for _, val := range self.Tasks {
+		names = append(names, val.Task)
+	}
+	sort.Strings(names)
+	return fmt.Sprintf(`known tasks: %q`, names)
+}
+
+type recorder struct {
+	lock   sync.Mutex
+	events []gtg.Event
+}
+
+func (self *recorder) Observe(val gtg.Event) {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	self.events = append(self.events, val)
+}
+
+func (self *recorder) list() []gtg.Event {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	return append([]gtg.Event(nil), self.events...)
+}
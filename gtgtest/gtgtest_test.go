@@ -0,0 +1,132 @@
+package gtgtest
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mitranim/gtg"
+)
+
+var errLint = errors.New(`lint failed`)
+
+func Main(task gtg.Task) error {
+	return gtg.Par(Build, Check)(task)
+}
+
+func Build(gtg.Task) error { return nil }
+
+func Generate(gtg.Task) error {
+	time.Sleep(time.Millisecond)
+	return nil
+}
+
+func Check(task gtg.Task) error {
+	_ = gtg.Wait(task, Lint)
+	return gtg.Wait(task, gtg.Unless(always, Format))
+}
+
+func Lint(gtg.Task) error   { return errLint }
+func Format(gtg.Task) error { return nil }
+func always(gtg.Task) bool  { return true }
+
+func init() {
+	gtg.Deps(Build, Generate)
+}
+
+func TestRecording(t *testing.T) {
+	rec := RunConf(t, gtg.Conf{Observer: gtg.ObserverFunc(func(gtg.Event) {})}, Main)
+	eq(t, nil, rec.Err)
+
+	rec.AssertRan(t, "Main", "Build", "Generate", "Check", "Lint")
+	rec.AssertNotRan(t, "Format")
+	rec.AssertRuns(t, "Build", 1)
+	rec.AssertOrder(t, "Generate", "Build")
+	rec.AssertErr(t, "Lint", errLint)
+	rec.AssertErr(t, "Check", nil)
+	rec.AssertStatus(t, "Unless(always, Format)", gtg.StatusSkipped)
+	rec.AssertEdge(t, "Build", "Generate")
+	rec.AssertEdge(t, "Check", "Lint")
+
+	eq(t, 0, rec.Runs("Format"))
+	_, ok := rec.Task("Format")
+	eq(t, false, ok)
+	eq(t, true, len(rec.Events) > 0)
+	eq(t, 5, len(rec.Edges()))
+}
+
+func TestAssertionFailures(t *testing.T) {
+	rec := Run(t, Main)
+	var fake fakeTB
+
+	rec.AssertRan(&fake, "Format")
+	rec.AssertNotRan(&fake, "Build")
+	rec.AssertRuns(&fake, "Build", 2)
+	rec.AssertOrder(&fake, "Build", "Generate")
+	rec.AssertErr(&fake, "Lint", nil)
+	rec.AssertErr(&fake, "Check", errLint)
+	rec.AssertStatus(&fake, "Check", gtg.StatusFailed)
+	rec.AssertEdge(&fake, "Generate", "Build")
+
+	eq(t, []string{
+		`expected task "Format" to run; known tasks: ["Build" "Check" "Generate" "Lint" "Main" "Unless(always, Format)"]`,
+		`expected task "Build" not to run, but it ran 1 times`,
+		`expected task "Build" to run 2 times, but it ran 1 times`,
+		`expected task "Build" to finish before task "Generate" started`,
+		`expected task "Lint" to succeed, but it failed: task "Lint" erred: lint failed`,
+		`expected error of task "Check" to match "lint failed", got: <nil>`,
+		`expected task "Check" to be failed, but it's done`,
+		`expected task "Generate" to wait on task "Build"; recorded edges: `,
+	}, fake.trimmed())
+}
+
+func TestRunDrain(t *testing.T) {
+	block := make(chan struct{})
+	defer close(block)
+
+	var fake fakeTB
+	rec := RunConf(&fake, gtg.Conf{Drain: time.Millisecond}, func(task gtg.Task) error {
+		task.Task(func(gtg.Task) error {
+			<-block
+			return nil
+		})
+		return nil
+	})
+
+	eq(t, nil, rec.Err)
+	eq(t, 1, len(fake.errs))
+	eq(t, true, strings.HasPrefix(fake.errs[0], `1 tasks still running after 1ms`))
+}
+
+type fakeTB struct {
+	testing.TB
+	errs []string
+}
+
+func (*fakeTB) Helper() {}
+
+func (self *fakeTB) Errorf(pattern string, args ...interface{}) {
+	self.errs = append(self.errs, fmt.Sprintf(pattern, args...))
+}
+
+// Cuts off the recorded edges, whose order depends on timing.
+func (self *fakeTB) trimmed() []string {
+	var out []string
+	for _, val := range self.errs {
+		ind := strings.Index(val, "recorded edges: ")
+		if ind >= 0 {
+			val = val[:ind+len("recorded edges: ")]
+		}
+		out = append(out, val)
+	}
+	return out
+}
+
+func eq(t testing.TB, expected, actual interface{}) {
+	t.Helper()
+	if fmt.Sprintf(`%#v`, expected) != fmt.Sprintf(`%#v`, actual) {
+		t.Fatalf("\nexpected: %#v\nactual:   %#v", expected, actual)
+	}
+}